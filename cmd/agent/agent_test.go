@@ -1,68 +1,809 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/go-resty/resty/v2"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/shirou/gopsutil/v4/mem"
+	psnet "github.com/shirou/gopsutil/v4/net"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
 
 	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+	retryerr "github.com/Tanya1515/metrics-collector.git/cmd/errors"
+	pb "github.com/Tanya1515/metrics-collector.git/cmd/proto"
+	retry "github.com/Tanya1515/metrics-collector.git/cmd/retry"
 )
 
-func TestGetMetricsUtil(t *testing.T) {
-	chanSend := make(chan int64)
-	chanMetrics := make(chan []data.Metrics)
-	result := make([]string, 3)
+func TestSystemCollector(t *testing.T) {
+	result := make([]string, 0)
 
-	test := struct {
-		name  string
-		timer time.Duration
+	collector := NewSystemCollector()
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+
+	for _, metric := range metrics {
+		assert.Equal(t, "gauge", metric.MType)
+		result = append(result, metric.ID)
+		if metric.ID == "TotalMemory" {
+			assert.Positive(t, *metric.Value)
+		}
+	}
+	for _, name := range []string{"TotalMemory", "FreeMemory", "AvailableMemory", "UsedMemory", "CachedMemory", "BuffersMemory",
+		"UsedMemoryPercent", "SwapTotal", "SwapUsed", "SwapFree", "Load1", "Load5", "Load15"} {
+		assert.Contains(t, result, name)
+	}
+
+	cpuCount, err := cpu.Counts(true)
+	require.NoError(t, err)
+	for i := 0; i < cpuCount; i++ {
+		assert.Contains(t, result, "CPUutilization"+strconv.Itoa(i))
+	}
+}
+
+func TestSystemCollectorValues(t *testing.T) {
+	collector := &SystemCollector{
+		virtualMemory: func(ctx context.Context) (*mem.VirtualMemoryStat, error) {
+			return &mem.VirtualMemoryStat{Total: 1000, Free: 100, Available: 300, Used: 600, Cached: 200, Buffers: 50, UsedPercent: 60}, nil
+		},
+		swapMemory: func(ctx context.Context) (*mem.SwapMemoryStat, error) {
+			return nil, errors.New("swap is not supported")
+		},
+		loadAverage: func(ctx context.Context) (*load.AvgStat, error) {
+			return &load.AvgStat{Load1: 0.5, Load5: 0.25, Load15: 0.125}, nil
+		},
+		cpuUtilization: func(ctx context.Context, interval time.Duration, percpu bool) ([]float64, error) {
+			return []float64{10, 20}, nil
+		},
+	}
+
+	metrics, err := collector.Collect(context.Background())
+	assert.Error(t, err)
+
+	result := make(map[string]float64)
+	for _, metric := range metrics {
+		result[metric.ID] = *metric.Value
+	}
+	assert.Equal(t, map[string]float64{
+		"TotalMemory": 1000, "FreeMemory": 100, "AvailableMemory": 300, "UsedMemory": 600, "CachedMemory": 200, "BuffersMemory": 50,
+		"UsedMemoryPercent": 60, "Load1": 0.5, "Load5": 0.25, "Load15": 0.125, "CPUutilization0": 10, "CPUutilization1": 20,
+	}, result)
+}
+
+func TestRuntimeCollector(t *testing.T) {
+	result := make([]string, 0)
+
+	collector := &RuntimeCollector{}
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+
+	for _, metric := range metrics {
+		result = append(result, metric.ID)
+		if metric.ID == "PollCount" {
+			assert.Equal(t, int64(1), *metric.Delta)
+		}
+	}
+	assert.Contains(t, result, "TotalAlloc")
+	assert.Contains(t, result, "RandomValue")
+	assert.Contains(t, result, "HeapReleased")
+	assert.Contains(t, result, "Lookups")
+	assert.Contains(t, result, "MCacheInuse")
+	assert.Contains(t, result, "PollCount")
+}
+
+func TestGoCollector(t *testing.T) {
+	collector := NewGoCollector()
+	_, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+
+	runtime.GC()
+	done := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		go func() { done <- struct{}{} }()
+		<-done
+	}
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+
+	types := make(map[string]string)
+	quantiles := make(map[string][]string)
+	for _, metric := range metrics {
+		assert.Regexp(t, "^go_[a-zA-Z0-9_:]+$", metric.ID)
+		assert.Equal(t, metric.ID, data.SanitizePrometheusName(metric.ID))
+		types[metric.ID] = metric.MType
+		if quantile, ok := metric.Labels["quantile"]; ok {
+			quantiles[metric.ID] = append(quantiles[metric.ID], quantile)
+		}
+	}
+	assert.Equal(t, "gauge", types["go_sched_goroutines:goroutines"])
+	assert.Equal(t, "counter", types["go_gc_cycles_total:gc_cycles"])
+	assert.Contains(t, types, "go_cpu_classes_gc_mark_assist:cpu_seconds")
+	assert.Equal(t, []string{"0.5", "0.9", "0.99"}, quantiles["go_sched_latencies:seconds"])
+	assert.Equal(t, "counter", types["go_sched_latencies:seconds_count"])
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	buckets := []float64{math.Inf(-1), 1, 2, 4, math.Inf(1)}
+	tests := []struct {
+		name   string
+		counts []uint64
+		q      float64
+		result float64
+	}{
+		{name: "test: median in the second bucket", counts: []uint64{0, 2, 2, 0}, q: 0.5, result: 2},
+		{name: "test: quantile in the third bucket", counts: []uint64{0, 2, 2, 0}, q: 0.9, result: 4},
+		{name: "test: quantile in the last bucket", counts: []uint64{0, 1, 0, 1}, q: 0.99, result: 4},
+		{name: "test: empty histogram", counts: []uint64{0, 0, 0, 0}, q: 0.5, result: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.result, histogramQuantile(test.counts, buckets, test.q))
+		})
+	}
+}
+
+func TestNewCollectors(t *testing.T) {
+	disabled := false
+	enabled := true
+	tests := []struct {
+		name     string
+		configs  map[string]data.CollectorConfig
+		expected map[string]time.Duration
+		wantErr  bool
 	}{
-		name:  "test: collect metrics",
-		timer: 1,
+		{
+			name:     "test: default collectors",
+			expected: map[string]time.Duration{RuntimeCollectorName: 2 * time.Second, SystemCollectorName: 2 * time.Second, GoCollectorName: 2 * time.Second},
+		},
+		{
+			name: "test: disable collector and change interval",
+			configs: map[string]data.CollectorConfig{
+				RuntimeCollectorName: {Interval: "5s"},
+				SystemCollectorName:  {Enabled: &disabled},
+				DiskCollectorName:    {Enabled: &disabled},
+				NetCollectorName:     {Enabled: &disabled},
+				GoCollectorName:      {Enabled: &disabled},
+			},
+			expected: map[string]time.Duration{RuntimeCollectorName: 5 * time.Second},
+		},
+		{
+			name: "test: enable aggregating collector",
+			configs: map[string]data.CollectorConfig{
+				RuntimeCollectorName: {Enabled: &disabled},
+				SystemCollectorName:  {Enabled: &disabled},
+				DiskCollectorName:    {Enabled: &disabled},
+				NetCollectorName:     {Enabled: &disabled},
+				GoCollectorName:      {Enabled: &disabled},
+				StatsDCollectorName:  {Enabled: &enabled},
+			},
+			expected: map[string]time.Duration{StatsDCollectorName: 10 * time.Second},
+		},
+		{
+			name:    "test: unknown collector",
+			configs: map[string]data.CollectorConfig{"test": {}},
+			wantErr: true,
+		},
+		{
+			name:    "test: invalid interval",
+			configs: map[string]data.CollectorConfig{RuntimeCollectorName: {Interval: "0s"}},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scheduled, err := NewCollectors(test.configs, 2*time.Second, 10*time.Second)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			result := make(map[string]time.Duration)
+			for _, collector := range scheduled {
+				result[collector.Collector.Name()] = collector.Interval
+			}
+			assert.Equal(t, test.expected, result)
+		})
 	}
+}
 
-	t.Run(test.name, func(t *testing.T) {
-		go GetMetricsUtil(context.Background(), chanSend, chanMetrics, test.timer)
-		chanSend <- -1
-		metrics := <-chanMetrics
+func TestSnapshot(t *testing.T) {
+	snapshot := &Snapshot{}
+	gauge := 1.5
+	delta := int64(2)
+	snapshot.Add([]data.Metrics{
+		{ID: "Alloc", MType: "gauge", Value: &gauge},
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+	})
+	gauge = 2.5
+	snapshot.Add([]data.Metrics{
+		{ID: "Alloc", MType: "gauge", Value: &gauge},
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+	})
 
+	values := func(metrics []data.Metrics) map[string]float64 {
+		result := make(map[string]float64)
 		for _, metric := range metrics {
-			result = append(result, metric.ID)
+			if metric.Delta != nil {
+				result[metric.ID] = float64(*metric.Delta)
+			} else {
+				result[metric.ID] = *metric.Value
+			}
+		}
+		return result
+	}
+
+	taken := snapshot.Take()
+	assert.Equal(t, map[string]float64{"Alloc": 2.5, "PollCount": 4}, values(taken))
+
+	snapshot.Add([]data.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}})
+	snapshot.Return(taken)
+	assert.Equal(t, map[string]float64{"Alloc": 2.5, "PollCount": 6}, values(snapshot.Take()))
+
+	assert.Equal(t, map[string]float64{"Alloc": 2.5}, values(snapshot.Take()))
+}
+
+func TestDiskCollector(t *testing.T) {
+	readBytes := uint64(100)
+	collector := &DiskCollector{
+		ExcludeMounts:  []string{"/boot", "/boot/*"},
+		ExcludeFSTypes: defaultExcludeFSTypes,
+		partitions: func(ctx context.Context, all bool) ([]disk.PartitionStat, error) {
+			return []disk.PartitionStat{
+				{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+				{Device: "/dev/sda2", Mountpoint: "/boot/efi", Fstype: "vfat"},
+				{Device: "tmpfs", Mountpoint: "/run", Fstype: "tmpfs"},
+			}, nil
+		},
+		usage: func(ctx context.Context, path string) (*disk.UsageStat, error) {
+			return &disk.UsageStat{Path: path, Total: 100, Used: 40, Free: 60, InodesTotal: 10, InodesUsed: 3, InodesFree: 7}, nil
+		},
+		ioCounters: func(ctx context.Context, names ...string) (map[string]disk.IOCountersStat, error) {
+			assert.Equal(t, []string{"sda1"}, names)
+			return map[string]disk.IOCountersStat{"sda1": {Name: "sda1", ReadBytes: readBytes, WriteBytes: 10}}, nil
+		},
+	}
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 6)
+	for _, metric := range metrics {
+		assert.Equal(t, map[string]string{"mountpoint": "/", "device": "/dev/sda1", "fstype": "ext4"}, metric.Labels)
+		if metric.ID == "DiskUsedBytes" {
+			assert.Equal(t, 40.0, *metric.Value)
+		}
+	}
+
+	readBytes = 250
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 10)
+	deltas := make(map[string]int64)
+	for _, metric := range metrics {
+		if metric.MType == "counter" {
+			assert.Equal(t, map[string]string{"device": "sda1"}, metric.Labels)
+			deltas[metric.ID] = *metric.Delta
+		}
+	}
+	assert.Equal(t, map[string]int64{"DiskReadBytes": 150, "DiskWriteBytes": 0, "DiskReadOps": 0, "DiskWriteOps": 0}, deltas)
+
+	// statistics of devices are not reported, if all partitions are skipped
+	collector.IncludeMounts = []string{"/data"}
+	collector.ioCounters = func(ctx context.Context, names ...string) (map[string]disk.IOCountersStat, error) {
+		t.Errorf("statistics of devices are requested: %v", names)
+		return nil, nil
+	}
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
+
+func TestNetCollector(t *testing.T) {
+	procRoot := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(procRoot, "net"), 0755))
+	header := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+	require.NoError(t, os.WriteFile(filepath.Join(procRoot, "net", "tcp"), []byte(header+
+		"   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 12345 1\n"+
+		"   1: 0100007F:1F90 0100007F:A1B2 01 00000000:00000000 00:00000000 00000000  1000        0 12346 1\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(procRoot, "net", "tcp6"), []byte(header+
+		"   0: 00000000000000000000000001000000:1F90 00000000000000000000000001000000:A1B3 01 00000000:00000000 00:00000000 00000000  1000        0 12347 1\n"), 0644))
+
+	bytesSent := uint64(1000)
+	collector := &NetCollector{
+		ExcludeInterfaces: defaultExcludeInterfaces,
+		ioCounters: func(ctx context.Context, pernic bool) ([]psnet.IOCountersStat, error) {
+			return []psnet.IOCountersStat{
+				{Name: "lo", BytesSent: bytesSent},
+				{Name: "veth1a2b", BytesSent: bytesSent},
+				{Name: "eth0", BytesSent: bytesSent, Dropin: 3},
+			}, nil
+		},
+		ProcRoot: procRoot,
+	}
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, len(tcpStates))
+
+	connections := make(map[string]float64)
+	for _, metric := range metrics {
+		assert.Equal(t, "NetTCPConnections", metric.ID)
+		connections[metric.Labels["state"]] = *metric.Value
+	}
+	assert.Equal(t, 2.0, connections["ESTABLISHED"])
+	assert.Equal(t, 1.0, connections["LISTEN"])
+	assert.Equal(t, 0.0, connections["TIME_WAIT"])
+
+	bytesSent = 1500
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, len(tcpStates)+8)
+	for _, metric := range metrics {
+		if metric.MType != "counter" {
+			continue
+		}
+		assert.Equal(t, map[string]string{"interface": "eth0"}, metric.Labels)
+		if metric.ID == "NetBytesSent" {
+			assert.Equal(t, int64(500), *metric.Delta)
 		}
-		assert.Contains(t, result, "TotalMemory")
-		assert.Contains(t, result, "FreeMemory")
-		assert.Contains(t, result, "CPUutilization1")
+	}
+}
+
+func TestProcessCollector(t *testing.T) {
+	pidfile := filepath.Join(t.TempDir(), "agent.pid")
+	require.NoError(t, os.WriteFile(pidfile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644))
+	executable := filepath.Base(os.Args[0])
+
+	collector, err := NewProcessCollector([]data.ProcessMatcher{
+		{Name: "pidfile", Pidfile: pidfile},
+		{Name: "cmdline", Cmdline: regexp.QuoteMeta(executable)},
+		{Name: "name", Process: executable},
+		{Name: "missing", Process: "missing-process-name"},
 	})
+	require.NoError(t, err)
+
+	_, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+
+	counts := make(map[string]float64)
+	series := make(map[string]map[string]float64)
+	for _, metric := range metrics {
+		if metric.ID == "ProcessCount" {
+			counts[metric.Labels["process"]] = *metric.Value
+			continue
+		}
+		assert.Equal(t, strconv.Itoa(os.Getpid()), metric.Labels["pid"])
+		if series[metric.Labels["process"]] == nil {
+			series[metric.Labels["process"]] = make(map[string]float64)
+		}
+		series[metric.Labels["process"]][metric.ID] = *metric.Value
+	}
+
+	assert.Equal(t, map[string]float64{"pidfile": 1, "cmdline": 1, "name": 1, "missing": 0}, counts)
+	require.Contains(t, series, "pidfile")
+	assert.Positive(t, series["pidfile"]["ProcessRSS"])
+	assert.Positive(t, series["pidfile"]["ProcessThreads"])
+	assert.Positive(t, series["pidfile"]["ProcessOpenFDs"])
+	assert.Contains(t, series["pidfile"], "ProcessCPUPercent")
+	assert.Contains(t, series["pidfile"], "ProcessUptime")
+}
+
+func TestNewProcessCollector(t *testing.T) {
+	tests := []struct {
+		name     string
+		matchers []data.ProcessMatcher
+	}{
+		{name: "test: without matchers"},
+		{name: "test: matcher without name", matchers: []data.ProcessMatcher{{Process: "server"}}},
+		{name: "test: matcher without rule", matchers: []data.ProcessMatcher{{Name: "server"}}},
+		{name: "test: matcher with several rules", matchers: []data.ProcessMatcher{{Name: "server", Process: "server", Pidfile: "/run/server.pid"}}},
+		{name: "test: matcher with invalid regexp", matchers: []data.ProcessMatcher{{Name: "server", Cmdline: "server("}}},
+		{name: "test: matchers with the same name", matchers: []data.ProcessMatcher{{Name: "server", Process: "server"}, {Name: "server", Process: "agent"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewProcessCollector(test.matchers)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCgroupCollector(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "system.slice", "agent.service")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+
+	writeFiles := func(usage int, throttled int, oomKills int, rbytes int) {
+		files := map[string]string{
+			"cpu.stat":       fmt.Sprintf("usage_usec %d\nuser_usec 100\nsystem_usec 50\nnr_periods 10\nnr_throttled %d\nthrottled_usec 300\n", usage, throttled),
+			"memory.current": "256\n",
+			"memory.max":     "1024\n",
+			"memory.events":  fmt.Sprintf("low 0\nhigh 0\nmax 2\noom 1\noom_kill %d\n", oomKills),
+			"io.stat":        fmt.Sprintf("8:0 rbytes=%d wbytes=20 rios=3 wios=4 dbytes=0 dios=0\n", rbytes),
+			"pids.current":   "7\n",
+		}
+		for name, content := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+		}
+	}
+
+	collector := &CgroupCollector{Root: root, Path: "/system.slice/agent.service"}
+	writeFiles(1000, 1, 0, 100)
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+
+	gauges := make(map[string]float64)
+	for _, metric := range metrics {
+		require.Equal(t, "gauge", metric.MType)
+		assert.Equal(t, "/system.slice/agent.service", metric.Labels["cgroup"])
+		gauges[metric.ID] = *metric.Value
+	}
+	assert.Equal(t, map[string]float64{"CgroupMemoryUsage": 256, "CgroupMemoryLimit": 1024, "CgroupMemoryUsagePercent": 25, "CgroupPids": 7}, gauges)
+
+	writeFiles(5000, 3, 1, 400)
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+
+	counters := make(map[string]int64)
+	for _, metric := range metrics {
+		if metric.MType == "counter" {
+			counters[metric.ID] = *metric.Delta
+		} else if metric.ID == "CgroupCPUPercent" {
+			assert.Positive(t, *metric.Value)
+		}
+	}
+	assert.Equal(t, int64(4000), counters["CgroupCPUUsageUsec"])
+	assert.Equal(t, int64(2), counters["CgroupCPUThrottledPeriods"])
+	assert.Equal(t, int64(1), counters["CgroupOOMKills"])
+	assert.Equal(t, int64(0), counters["CgroupOOMEvents"])
+	assert.Equal(t, int64(300), counters["CgroupIOReadBytes"])
+
+	// cgroup without memory limit and disabled pids controller
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "memory.max"), []byte("max\n"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "pids.current")))
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	for _, metric := range metrics {
+		assert.NotContains(t, []string{"CgroupMemoryLimit", "CgroupMemoryUsagePercent", "CgroupPids"}, metric.ID)
+	}
+}
+
+func TestParseSelfCgroup(t *testing.T) {
+	path, err := parseSelfCgroup([]byte("0::/system.slice/agent.service\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "/system.slice/agent.service", path)
+
+	_, err = parseSelfCgroup([]byte("12:memory:/docker/abc\n11:cpu,cpuacct:/docker/abc\n"))
+	assert.Error(t, err)
 }
 
-func TestGetMetrics(t *testing.T) {
-	chanSend := make(chan int64)
-	chanMetrics := make(chan []data.Metrics)
-	result := make([]string, 3)
+func TestExecCollector(t *testing.T) {
+	collector, err := NewExecCollector([]data.ScriptConfig{
+		{Name: "json", Command: []string{"sh", "-c", `echo '[{"id": "QueueSize", "type": "gauge", "value": 12.5}]'`}},
+		{Name: "text", Command: []string{"sh", "-c", "echo '# processed jobs'; echo 'JobsProcessed counter 3'"}, Format: ScriptFormatText},
+		{Name: "failed", Command: []string{"sh", "-c", "echo 'Failed gauge 1'; exit 3"}},
+		{Name: "slow", Command: []string{"sleep", "5"}, Timeout: "1s"},
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	metrics, err := collector.Collect(context.Background())
+	assert.Less(t, time.Since(start), 4*time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "script failed")
+	assert.Contains(t, err.Error(), "script slow exceeded timeout")
+
+	values := make(map[string]float64)
+	exitCodes := make(map[string]float64)
+	for _, metric := range metrics {
+		switch {
+		case metric.ID == "ScriptExitCode":
+			exitCodes[metric.Labels["script"]] = *metric.Value
+		case metric.MType == "counter":
+			values[metric.ID] = float64(*metric.Delta)
+		case metric.ID != "ScriptDuration":
+			values[metric.ID] = *metric.Value
+		}
+	}
+	assert.Equal(t, map[string]float64{"QueueSize": 12.5, "JobsProcessed": 3}, values)
+	assert.Equal(t, map[string]float64{"json": 0, "text": 0, "failed": 3, "slow": -1}, exitCodes)
+}
 
-	test := struct {
-		name  string
-		timer time.Duration
+func TestParseScriptOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		format  string
+		wantErr bool
 	}{
-		name:  "test: collect metrics",
-		timer: 1,
+		{name: "test: detect json format", output: `[{"id": "Alloc", "type": "gauge", "value": 1}]`},
+		{name: "test: text format", output: "Alloc gauge 1\n\nPollCount counter 2\n"},
+		{name: "test: json without value", output: `[{"id": "Alloc", "type": "gauge"}]`, wantErr: true},
+		{name: "test: json in text format", output: `[{"id": "Alloc", "type": "gauge", "value": 1}]`, format: ScriptFormatText, wantErr: true},
+		{name: "test: counter with float value", output: "PollCount counter 1.5", wantErr: true},
+		{name: "test: unknown type", output: "Alloc histogram 1", wantErr: true},
+		{name: "test: NaN gauge", output: "Alloc gauge NaN", wantErr: true},
+		{name: "test: infinite gauge", output: "Alloc gauge +Inf", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			metrics, err := parseScriptOutput([]byte(test.output), test.format)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, metrics)
+		})
+	}
+}
+
+func TestStatsDCollector(t *testing.T) {
+	collector := &StatsDCollector{}
+	for _, line := range []string{
+		"requests:1|c",
+		"requests:1|c|@0.5",
+		"requests:2|c|#route:/api",
+		"queue:10|g",
+		"queue:+5|g",
+		"queue:-3|g",
+		"latency:30|ms",
+		"latency:10|ms",
+		"latency:20|h",
+		"db:5|ms|@0.1",
+		"db:7|ms",
+		"users:alice|s",
+		"users:bob|s",
+		"users:alice|s",
+		"broken line",
+		"requests:x|c",
+		"queue:NaN|g",
+		"queue:+Inf|g",
+		"requests:Inf|c",
+		"big:1e308|g",
+		"big:+1e308|g",
+		"requests:1e19|c",
+	} {
+		collector.handleLine(line)
 	}
 
-	t.Run(test.name, func(t *testing.T) {
-		go GetMetrics(context.Background(), chanSend, chanMetrics, test.timer)
-		chanSend <- -1
-		metrics := <-chanMetrics
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+	for _, metric := range metrics {
+		key := metric.Key()
+		if metric.Delta != nil {
+			values[key] = float64(*metric.Delta)
+		} else {
+			values[key] = *metric.Value
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"requests":                 3,
+		`requests{route="/api"}`:   2,
+		"queue":                    12,
+		"latency_count":            3,
+		"latency_min":              10,
+		"latency_max":              30,
+		"latency_mean":             20,
+		`latency{quantile="0.5"}`:  20,
+		`latency{quantile="0.9"}`:  30,
+		`latency{quantile="0.99"}`: 30,
+		"db_count":                 11,
+		"db_min":                   5,
+		"db_max":                   7,
+		"db_mean":                  6,
+		`db{quantile="0.5"}`:       5,
+		`db{quantile="0.9"}`:       7,
+		`db{quantile="0.99"}`:      7,
+		"users":                    2,
+		"big":                      1e308,
+		"StatsDInvalidLines":       7,
+	}, values)
+
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	keys := make([]string, 0)
+	for _, metric := range metrics {
+		keys = append(keys, metric.ID)
+	}
+	assert.ElementsMatch(t, []string{"queue", "big", "StatsDInvalidLines"}, keys)
+}
+
+func TestStatsDCollectorSampleRateRemainder(t *testing.T) {
+	collector := &StatsDCollector{}
 
+	// remainders of scaled counter and timer count are carried into the next collections
+	deltas := make(map[string][]int64)
+	for i := 0; i < 3; i++ {
+		collector.handleLine("requests:1|c|@0.3")
+		collector.handleLine("latency:10|ms|@0.3")
+		metrics, err := collector.Collect(context.Background())
+		require.NoError(t, err)
 		for _, metric := range metrics {
-			result = append(result, metric.ID)
+			if metric.Delta != nil {
+				deltas[metric.ID] = append(deltas[metric.ID], *metric.Delta)
+			}
 		}
-		assert.Contains(t, result, "TotalAlloc")
-		assert.Contains(t, result, "RandomValue")
-		assert.Contains(t, result, "HeapReleased")
-		assert.Contains(t, result, "Lookups")
-		assert.Contains(t, result, "MCacheInuse")
+	}
+	assert.Equal(t, []int64{3, 4, 3}, deltas["requests"])
+	assert.Equal(t, []int64{3, 4, 3}, deltas["latency_count"])
+
+	// series without new samples are not reported
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "StatsDInvalidLines", metrics[0].ID)
+}
+
+func TestStatsDListener(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	collector := &StatsDCollector{UDPAddress: "127.0.0.1:0", TCPAddress: "127.0.0.1:0"}
+	require.NoError(t, collector.Listen(ctx))
+
+	udpConn, err := net.Dial("udp", collector.udpConn.LocalAddr().String())
+	require.NoError(t, err)
+	defer udpConn.Close()
+	_, err = udpConn.Write([]byte("udp.requests:1|c\nudp.queue:4|g"))
+	require.NoError(t, err)
+
+	tcpConn, err := net.Dial("tcp", collector.tcpListener.Addr().String())
+	require.NoError(t, err)
+	_, err = tcpConn.Write([]byte("tcp.requests:2|c\n"))
+	require.NoError(t, err)
+	require.NoError(t, tcpConn.Close())
+
+	received := make(map[string]struct{})
+	assert.Eventually(t, func() bool {
+		metrics, err := collector.Collect(context.Background())
+		require.NoError(t, err)
+		for _, metric := range metrics {
+			received[metric.ID] = struct{}{}
+		}
+		return len(received) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestMatchFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		include []string
+		exclude []string
+		result  bool
+	}{
+		{name: "test: empty filters", value: "/", result: true},
+		{name: "test: value is included", value: "/data", include: []string{"/data*"}, result: true},
+		{name: "test: value is not included", value: "/", include: []string{"/data*"}, result: false},
+		{name: "test: value is excluded", value: "tmpfs", exclude: []string{"tmpfs"}, result: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.result, matchFilter(test.value, test.include, test.exclude))
+		})
+	}
+}
+
+func TestSnapshotAddFrom(t *testing.T) {
+	snapshot := &Snapshot{}
+	value := 1.0
+	snapshot.AddFrom(ProcessCollectorName, []data.Metrics{
+		{ID: "ProcessRSS", MType: "gauge", Value: &value, Labels: map[string]string{"pid": "1"}},
+		{ID: "ProcessRSS", MType: "gauge", Value: &value, Labels: map[string]string{"pid": "2"}},
+	})
+	snapshot.AddFrom(RuntimeCollectorName, []data.Metrics{{ID: "Alloc", MType: "gauge", Value: &value}})
+	snapshot.AddFrom(ProcessCollectorName, []data.Metrics{
+		{ID: "ProcessRSS", MType: "gauge", Value: &value, Labels: map[string]string{"pid": "2"}},
+	})
+
+	keys := make([]string, 0)
+	for _, metric := range snapshot.Take() {
+		keys = append(keys, metric.Key())
+	}
+	assert.ElementsMatch(t, []string{"Alloc", `ProcessRSS{pid="2"}`}, keys)
+}
+
+func TestAgentStatusHandler(t *testing.T) {
+	spool := &Spool{Dir: t.TempDir()}
+	require.NoError(t, spool.Init())
+	delta := int64(5)
+	require.NoError(t, spool.Push([]data.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}}))
+
+	status := &AgentStatus{
+		ServerAddress:  "localhost:8080",
+		Transport:      TransportHTTP,
+		PollInterval:   2 * time.Second,
+		ReportInterval: 10 * time.Second,
+		Spool:          spool,
+		InFlight:       func() int { return 1 },
+	}
+	value := 1.5
+	status.SetBatch([]data.Metrics{{ID: "Alloc", MType: "gauge", Value: &value, Labels: map[string]string{"host": "a"}}})
+	status.Retry()
+	status.SendResult(errors.New("connection refused"), time.Now())
+	status.SendResult(nil, time.Now())
+
+	server := httptest.NewServer(status.Handler())
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.NoError(t, response.Body.Close())
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, string(body), `Alloc{host="a"} 1.5`)
+
+	response, err = http.Get(server.URL + "/metrics.json")
+	require.NoError(t, err)
+	var batch []data.Metrics
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&batch))
+	require.NoError(t, response.Body.Close())
+	require.Len(t, batch, 1)
+	assert.Equal(t, "Alloc", batch[0].ID)
+
+	response, err = http.Get(server.URL + "/status")
+	require.NoError(t, err)
+	var result statusResponse
+	require.NoError(t, json.NewDecoder(response.Body).Decode(&result))
+	require.NoError(t, response.Body.Close())
+	assert.Equal(t, "localhost:8080", result.ServerAddress)
+	assert.Equal(t, "10s", result.ReportInterval)
+	assert.Equal(t, "connection refused", result.LastError)
+	assert.NotNil(t, result.LastSend)
+	assert.Equal(t, int64(1), result.Retries)
+	assert.Equal(t, 1, result.InFlight)
+	assert.Equal(t, 1, result.QueueDepth)
+	assert.Equal(t, 1, result.BatchSize)
+
+	// profiles are not served by debug endpoint
+	response, err = http.Get(server.URL + "/debug/pprof/")
+	require.NoError(t, err)
+	require.NoError(t, response.Body.Close())
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	var nilStatus *AgentStatus
+	assert.NotPanics(t, func() {
+		nilStatus.Retry()
+		nilStatus.SetBatch(batch)
+		nilStatus.SendResult(nil, time.Now())
 	})
 }
 
@@ -93,6 +834,345 @@ func TestMakeMetrics(t *testing.T) {
 
 }
 
+// testServer - server, which counts received batches and can be switched to failing state.
+type testServer struct {
+	server  *httptest.Server
+	mutex   sync.Mutex
+	down    bool
+	batches int
+	pings   int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	ts := &testServer{}
+	ts.server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ts.mutex.Lock()
+		defer ts.mutex.Unlock()
+		if r.URL.Path == "/ping" {
+			ts.pings++
+		}
+		if ts.down {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Path == "/updates/" {
+			ts.batches++
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(ts.server.Close)
+
+	return ts
+}
+
+func (ts *testServer) address() string {
+	return strings.TrimPrefix(ts.server.URL, "http://")
+}
+
+func (ts *testServer) setDown(down bool) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	ts.down = down
+}
+
+func (ts *testServer) counts() (int, int) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	return ts.batches, ts.pings
+}
+
+// sendTestBatch - function, that posts batch and treats error status as failure.
+func sendTestBatch(client *resty.Client) func(url string) error {
+	return func(url string) error {
+		response, err := client.R().SetBody("[]").Post(url)
+		if err == nil && response.IsError() {
+			return fmt.Errorf("server responded with status %s", response.Status())
+		}
+		return err
+	}
+}
+
+func TestDestinationsFailover(t *testing.T) {
+	first := newTestServer(t)
+	second := newTestServer(t)
+	client := resty.New()
+
+	destinations, err := NewDestinations(first.address()+", "+second.address(), StrategyFailover, client)
+	require.NoError(t, err)
+	send := sendTestBatch(client)
+
+	require.NoError(t, destinations.Send(send))
+	batches, _ := first.counts()
+	assert.Equal(t, 1, batches)
+
+	first.setDown(true)
+	require.NoError(t, destinations.Send(send))
+	batches, _ = second.counts()
+	assert.Equal(t, 1, batches)
+	states := destinations.States()
+	assert.False(t, states[0].Healthy)
+	assert.Equal(t, int64(1), states[0].Failures)
+	assert.True(t, states[1].Healthy)
+
+	// unhealthy server is skipped, until it responds to ping
+	require.NoError(t, destinations.Send(send))
+	batches, pings := first.counts()
+	assert.Equal(t, 1, batches)
+	assert.Equal(t, 1, pings)
+
+	first.setDown(false)
+	require.NoError(t, destinations.Send(send))
+	batches, _ = first.counts()
+	assert.Equal(t, 2, batches)
+	assert.True(t, destinations.States()[0].Healthy)
+
+	first.setDown(true)
+	second.setDown(true)
+	assert.Error(t, destinations.Send(send))
+}
+
+func TestDestinationsFanout(t *testing.T) {
+	first := newTestServer(t)
+	second := newTestServer(t)
+	client := resty.New()
+
+	destinations, err := NewDestinations(first.address()+","+second.address(), StrategyFanout, client)
+	require.NoError(t, err)
+	send := sendTestBatch(client)
+
+	require.NoError(t, destinations.Send(send))
+	second.setDown(true)
+	require.NoError(t, destinations.Send(send))
+
+	firstBatches, _ := first.counts()
+	secondBatches, _ := second.counts()
+	assert.Equal(t, 2, firstBatches)
+	assert.Equal(t, 1, secondBatches)
+	states := destinations.States()
+	assert.False(t, states[1].Healthy)
+	assert.Equal(t, int64(1), states[1].Failures)
+	assert.Equal(t, 1, states[1].Pending)
+
+	// queued batch is sent to server before the new one
+	second.setDown(false)
+	require.NoError(t, destinations.Send(send))
+	secondBatches, _ = second.counts()
+	assert.Equal(t, 3, secondBatches)
+	assert.Equal(t, 0, destinations.States()[1].Pending)
+
+	// batch, which was not accepted by any server, is not queued
+	first.setDown(true)
+	second.setDown(true)
+	assert.Error(t, destinations.Send(send))
+	for _, state := range destinations.States() {
+		assert.Equal(t, 0, state.Pending)
+	}
+}
+
+func TestDestinationsFanoutMaxPending(t *testing.T) {
+	first := newTestServer(t)
+	second := newTestServer(t)
+	client := resty.New()
+
+	destinations, err := NewDestinations(first.address()+","+second.address(), StrategyFanout, client)
+	require.NoError(t, err)
+	destinations.MaxPending = 2
+	send := sendTestBatch(client)
+
+	second.setDown(true)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, destinations.Send(send))
+	}
+
+	states := destinations.States()
+	assert.Equal(t, 2, states[1].Pending)
+	assert.Equal(t, int64(1), states[1].Dropped)
+}
+
+func TestDestinationsFanoutConcurrentPending(t *testing.T) {
+	server := newTestServer(t)
+	destinations, err := NewDestinations(server.address(), StrategyFanout, resty.New())
+	require.NoError(t, err)
+	destination := destinations.List[0]
+
+	var mutex sync.Mutex
+	sent := make(map[int]int)
+	for i := 0; i < 10; i++ {
+		destinations.enqueue(destination, func(url string) error {
+			mutex.Lock()
+			sent[i]++
+			mutex.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, destinations.sendPending(destination, func(url string) error { return nil }))
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, sent, 10)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, 1, sent[i], "batch %d", i)
+	}
+	assert.Equal(t, 0, destinations.States()[0].Pending)
+}
+
+// newSigningServer - server, which checks sign of batches and signs its responses, batches are rejected while server is down.
+func newSigningServer(t *testing.T, secretKey string, down *bool, mutex *sync.Mutex) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		isDown := *down
+		mutex.Unlock()
+		if isDown {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Path == "/ping" {
+			rw.WriteHeader(http.StatusOK)
+			return
+		}
+
+		gz, err := gzip.NewReader(r.Body)
+		if !assert.NoError(t, err) {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+
+		timestamp := r.Header.Get(data.TimestampHeader)
+		nonce := r.Header.Get(data.NonceHeader)
+		if !assert.Equal(t, data.SignRequest(secretKey, timestamp, nonce, body), r.Header.Get("HashSHA256")) {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		response := []byte(`{"count":1}`)
+		rw.Header().Set("HashSHA256", data.SignRequest(secretKey, timestamp, nonce, response))
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(response)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestSendMetricsHTTPFanoutSigned(t *testing.T) {
+	var mutex sync.Mutex
+	up, down := false, true
+	first := newSigningServer(t, "secret", &up, &mutex)
+	second := newSigningServer(t, "secret", &down, &mutex)
+	client := resty.New()
+
+	destinations, err := NewDestinations(strings.TrimPrefix(first.URL, "http://")+","+strings.TrimPrefix(second.URL, "http://"), StrategyFanout, client)
+	require.NoError(t, err)
+	policy := retry.Policy{MaxAttempts: 1}
+	metrics := MakeMetrics(map[string]float64{"Alloc": 1.5}, 3)
+
+	// batches are queued for the second server, then they are sent concurrently with new batches
+	for i := 0; i < 3; i++ {
+		require.NoError(t, SendMetricsHTTP(context.Background(), client, destinations, metrics, "secret", nil, policy))
+	}
+	assert.Equal(t, 3, destinations.States()[1].Pending)
+
+	mutex.Lock()
+	down = false
+	mutex.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, SendMetricsHTTP(context.Background(), client, destinations, metrics, "secret", nil, policy))
+		}()
+	}
+	wg.Wait()
+
+	for _, state := range destinations.States() {
+		assert.True(t, state.Healthy)
+		assert.Equal(t, 0, state.Pending)
+	}
+}
+
+func TestNewDestinations(t *testing.T) {
+	_, err := NewDestinations("localhost:8080", "roundrobin", resty.New())
+	assert.Error(t, err)
+
+	_, err = NewDestinations(" , ", StrategyFailover, resty.New())
+	assert.Error(t, err)
+
+	destinations, err := NewDestinations("localhost:8080,localhost:8081", StrategyFanout, resty.New())
+	require.NoError(t, err)
+	require.Len(t, destinations.List, 2)
+	assert.Equal(t, "http://localhost:8081/updates/", destinations.List[1].URL)
+}
+
+func TestCheckResponse(t *testing.T) {
+	body := []byte(`{"count":1}`)
+	timestamp := data.NewTimestamp(time.Now())
+	sign := data.SignRequest("secret", timestamp, "nonce", body)
+
+	tests := []struct {
+		name   string
+		status int
+		sign   string
+		gzip   bool
+		key    string
+		result retryerr.Result
+		ok     bool
+	}{
+		{name: "success without key", status: http.StatusOK, ok: true},
+		{name: "signed response", status: http.StatusOK, sign: sign, key: "secret", ok: true},
+		{name: "signed compressed response", status: http.StatusOK, sign: sign, gzip: true, key: "secret", ok: true},
+		{name: "unsigned response", status: http.StatusOK, key: "secret"},
+		{name: "wrong sign", status: http.StatusOK, sign: hex.EncodeToString([]byte("wrong")), key: "secret"},
+		{name: "response to another request", status: http.StatusOK, sign: data.SignRequest("secret", timestamp, "other", body), key: "secret"},
+		{name: "bad request", status: http.StatusBadRequest},
+		{name: "storage error", status: http.StatusInternalServerError},
+		{name: "unavailable", status: http.StatusServiceUnavailable, result: retryerr.Retryable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				if test.sign != "" {
+					rw.Header().Set("HashSHA256", test.sign)
+				}
+				if test.gzip {
+					rw.Header().Set("Content-Encoding", "gzip")
+					rw.WriteHeader(test.status)
+					gz := gzip.NewWriter(rw)
+					gz.Write(body)
+					gz.Close()
+					return
+				}
+				rw.WriteHeader(test.status)
+				rw.Write(body)
+			}))
+			defer server.Close()
+
+			response, err := resty.New().R().SetBody("[]").Post(server.URL)
+			require.NoError(t, err)
+
+			err = CheckResponse(response, test.key, timestamp, "nonce")
+			if test.ok {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, test.result, retryerr.Classify(err))
+		})
+	}
+}
+
 func TestMakeString(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -118,3 +1198,245 @@ func TestMakeString(t *testing.T) {
 		})
 	}
 }
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		name         string
+		labelsString string
+		result       map[string]string
+		wantErr      bool
+	}{
+		{
+			name:         "test: parse several labels",
+			labelsString: "dc=eu-1, rack=r12",
+			result:       map[string]string{"dc": "eu-1", "rack": "r12"},
+		},
+		{
+			name:         "test: parse empty string",
+			labelsString: "",
+			result:       map[string]string{},
+		},
+		{
+			name:         "test: parse label without value",
+			labelsString: "dc",
+			wantErr:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := ParseLabels(test.labelsString)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.result, result)
+		})
+	}
+}
+
+func TestAddLabels(t *testing.T) {
+	labels := IdentityLabels("node-1", "", "prod", map[string]string{"dc": "eu-1", "host": "other"})
+	assert.Equal(t, map[string]string{"host": "node-1", "env": "prod", "dc": "eu-1"}, labels)
+
+	metrics := MakeMetrics(map[string]float64{"Alloc": 1}, 1)
+	metrics[0].Labels = map[string]string{"device": "sda"}
+	AddLabels(metrics, labels)
+
+	assert.Equal(t, map[string]string{"host": "node-1", "env": "prod", "dc": "eu-1", "device": "sda"}, metrics[0].Labels)
+	assert.Equal(t, labels, metrics[1].Labels)
+}
+
+type testMetricsServer struct {
+	pb.UnimplementedMetricsServiceServer
+	requests   []*pb.UpdateMetricsRequest
+	signs      []string
+	timestamps []string
+	nonces     []string
+}
+
+func (s *testMetricsServer) UpdateMetrics(ctx context.Context, request *pb.UpdateMetricsRequest) (*pb.UpdateMetricsResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.signs = append(s.signs, md.Get(pb.HashMetadataKey)...)
+	s.timestamps = append(s.timestamps, md.Get(pb.TimestampMetadataKey)...)
+	s.nonces = append(s.nonces, md.Get(pb.NonceMetadataKey)...)
+	s.requests = append(s.requests, request)
+
+	return &pb.UpdateMetricsResponse{Count: int64(len(request.GetMetrics()))}, nil
+}
+
+func TestSendMetricsGRPC(t *testing.T) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := &testMetricsServer{}
+	grpcServer := grpc.NewServer()
+	pb.RegisterMetricsServiceServer(grpcServer, server)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsServiceClient(conn)
+
+	metrics := MakeMetrics(map[string]float64{"Alloc": 1.5}, 3)
+	AddLabels(metrics, map[string]string{"host": "a"})
+
+	require.NoError(t, SendMetricsGRPC(context.Background(), client, metrics, "secret", retry.DefaultPolicy()))
+	require.Len(t, server.requests, 1)
+	assert.ElementsMatch(t, metrics, server.requests[0].ToMetrics())
+
+	require.Len(t, server.timestamps, 1)
+	require.Len(t, server.nonces, 1)
+	sign, err := pb.Sign("secret", server.timestamps[0], server.nonces[0], pb.FromMetrics(metrics))
+	require.NoError(t, err)
+	assert.Equal(t, []string{sign}, server.signs)
+}
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+	spool := &Spool{Dir: dir}
+	require.NoError(t, spool.Init())
+
+	for i := int64(1); i <= 3; i++ {
+		delta := i
+		require.NoError(t, spool.Push([]data.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}}))
+	}
+
+	reloaded := &Spool{Dir: dir}
+	require.NoError(t, reloaded.Init())
+
+	sent := make([]int64, 0)
+	errSend := errors.New("server is unavailable")
+	err := reloaded.Replay(func(metrics []data.Metrics) error {
+		if len(sent) == 2 {
+			return errSend
+		}
+		sent = append(sent, *metrics[0].Delta)
+		return nil
+	})
+	assert.ErrorIs(t, err, errSend)
+	assert.Equal(t, []int64{1, 2}, sent)
+
+	selfMetrics := reloaded.SelfMetrics()
+	assert.Equal(t, 1.0, *selfMetrics[0].Value)
+
+	require.NoError(t, reloaded.Replay(func(metrics []data.Metrics) error {
+		sent = append(sent, *metrics[0].Delta)
+		return nil
+	}))
+	assert.Equal(t, []int64{1, 2, 3}, sent)
+	assert.Equal(t, 0.0, *reloaded.SelfMetrics()[0].Value)
+}
+
+func TestSpoolTemporarySegments(t *testing.T) {
+	dir := t.TempDir()
+	spool := &Spool{Dir: dir}
+	require.NoError(t, spool.Init())
+
+	delta := int64(1)
+	require.NoError(t, spool.Push([]data.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}}))
+
+	// segment, which was being written during crash, is removed and not replayed
+	tmpPath := spool.segmentPath(1) + tmpSuffix
+	require.NoError(t, os.WriteFile(tmpPath, []byte("test"), 0644))
+
+	reloaded := &Spool{Dir: dir}
+	require.NoError(t, reloaded.Init())
+	assert.NoFileExists(t, tmpPath)
+	pools, _ := reloaded.Size()
+	assert.Equal(t, 1, pools)
+
+	sent := make([]int64, 0)
+	require.NoError(t, reloaded.Replay(func(metrics []data.Metrics) error {
+		sent = append(sent, *metrics[0].Delta)
+		return nil
+	}))
+	assert.Equal(t, []int64{1}, sent)
+}
+
+func TestSpoolSend(t *testing.T) {
+	spool := &Spool{Dir: t.TempDir()}
+	require.NoError(t, spool.Init())
+
+	sent := make([]int64, 0)
+	errSend := errors.New("server is unavailable")
+	available := false
+	send := func(metrics []data.Metrics) error {
+		if !available {
+			return errSend
+		}
+		sent = append(sent, *metrics[0].Delta)
+		return nil
+	}
+
+	for i := int64(1); i <= 2; i++ {
+		delta := i
+		spooled, err := spool.Send([]data.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}}, send)
+		assert.ErrorIs(t, err, errSend)
+		assert.True(t, spooled)
+	}
+
+	// new pool is sent only after older pools from spool
+	available = true
+	delta := int64(3)
+	spooled, err := spool.Send([]data.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}}, send)
+	require.NoError(t, err)
+	assert.False(t, spooled)
+	assert.Equal(t, []int64{1, 2, 3}, sent)
+
+	pools, _ := spool.Size()
+	assert.Equal(t, 0, pools)
+}
+
+func TestSpoolReturnDropped(t *testing.T) {
+	spool := &Spool{Dir: t.TempDir()}
+	require.NoError(t, spool.Init())
+	spool.dropped = 2
+
+	selfMetrics := spool.SelfMetrics()
+	assert.Equal(t, int64(2), *selfMetrics[2].Delta)
+	assert.Equal(t, int64(0), *spool.SelfMetrics()[2].Delta)
+
+	// metrics of spool were not delivered, so dropped pools are reported again
+	spool.ReturnDropped(selfMetrics)
+	assert.Equal(t, int64(2), *spool.SelfMetrics()[2].Delta)
+}
+
+func TestSpoolEviction(t *testing.T) {
+	dir := t.TempDir()
+	spool := &Spool{Dir: dir}
+	require.NoError(t, spool.Init())
+
+	delta := int64(1)
+	require.NoError(t, spool.Push([]data.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}}))
+	spool.MaxBytes = spool.size
+
+	delta = 2
+	require.NoError(t, spool.Push([]data.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}}))
+	delta = 3
+	require.NoError(t, spool.Push([]data.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta}}))
+
+	// corrupt the only remaining segment, it must be skipped during replay
+	require.NoError(t, os.WriteFile(spool.segmentPath(spool.segments[0].seq), []byte("test"), 0644))
+
+	selfMetrics := spool.SelfMetrics()
+	assert.Equal(t, 1.0, *selfMetrics[0].Value)
+	assert.Equal(t, int64(2), *selfMetrics[2].Delta)
+
+	require.NoError(t, spool.Replay(func(metrics []data.Metrics) error {
+		t.Errorf("corrupted segment is replayed: %v", metrics)
+		return nil
+	}))
+
+	selfMetrics = spool.SelfMetrics()
+	assert.Equal(t, 0.0, *selfMetrics[0].Value)
+	assert.Equal(t, 0.0, *selfMetrics[1].Value)
+	assert.Equal(t, int64(1), *selfMetrics[2].Delta)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
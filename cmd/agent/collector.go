@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// Collector - interface, that describes source of metrics for agent.
+// Gauges, returned by Collect, replace previous values, counters are added to collected deltas.
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context) ([]data.Metrics, error)
+}
+
+// Listener - interface, that describes collector, which receives metrics in background between collections.
+// Listen must return after listener is ready, receiving stops, when context is canceled.
+type Listener interface {
+	Listen(ctx context.Context) error
+}
+
+// CollectorFactory - function, that creates collector from its configuration.
+type CollectorFactory func(config data.CollectorConfig) (Collector, error)
+
+// registration - data type to describe collector in registry.
+type registration struct {
+	factory CollectorFactory
+	enabled bool
+	report  bool
+}
+
+// reportedQuantiles - quantiles, which are reported for histograms and timers.
+var reportedQuantiles = []float64{0.5, 0.9, 0.99}
+
+// collectors - registry of all collectors, that can be run by agent.
+var collectors = make(map[string]registration)
+
+// RegisterCollector - function for adding collector to registry.
+// Enabled means, that collector is run, if it is not disabled in configuration.
+func RegisterCollector(name string, enabled bool, factory CollectorFactory) {
+	if _, ok := collectors[name]; ok {
+		panic("collector " + name + " is registered twice")
+	}
+	collectors[name] = registration{factory: factory, enabled: enabled}
+}
+
+// RegisterAggregatingCollector - function for adding collector, which aggregates received values between collections,
+// to registry. Such collector is run every report interval by default, so that aggregates cover all values, sent at once.
+func RegisterAggregatingCollector(name string, enabled bool, factory CollectorFactory) {
+	RegisterCollector(name, enabled, factory)
+	registered := collectors[name]
+	registered.report = true
+	collectors[name] = registered
+}
+
+// ScheduledCollector - data type to describe collector with its poll interval.
+type ScheduledCollector struct {
+	Collector Collector
+	Interval  time.Duration
+}
+
+// NewCollectors - function, that creates all enabled collectors from registry.
+// Collectors without interval in configuration are run with poll interval, aggregating collectors are run with report interval.
+func NewCollectors(configs map[string]data.CollectorConfig, pollInterval time.Duration, reportInterval time.Duration) ([]ScheduledCollector, error) {
+	for name := range configs {
+		if _, ok := collectors[name]; !ok {
+			return nil, fmt.Errorf("unknown collector %s", name)
+		}
+	}
+
+	names := make([]string, 0, len(collectors))
+	for name := range collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	scheduled := make([]ScheduledCollector, 0, len(names))
+	for _, name := range names {
+		config := configs[name]
+		enabled := collectors[name].enabled
+		if config.Enabled != nil {
+			enabled = *config.Enabled
+		}
+		if !enabled {
+			continue
+		}
+
+		interval := pollInterval
+		if collectors[name].report {
+			interval = reportInterval
+		}
+		if config.Interval != "" {
+			seconds, err := strconv.Atoi(strings.Split(config.Interval, "s")[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid interval of collector %s: %w", name, err)
+			}
+			if seconds <= 0 {
+				return nil, fmt.Errorf("invalid interval of collector %s: %s", name, config.Interval)
+			}
+			interval = time.Duration(seconds) * time.Second
+		}
+
+		collector, err := collectors[name].factory(config)
+		if err != nil {
+			return nil, fmt.Errorf("error while creating collector %s: %w", name, err)
+		}
+		scheduled = append(scheduled, ScheduledCollector{Collector: collector, Interval: interval})
+	}
+
+	return scheduled, nil
+}
+
+// RunCollector - function for collecting metrics every interval until context is canceled.
+// Listener of collector is started before the first collection.
+func RunCollector(ctx context.Context, collector ScheduledCollector, snapshot *Snapshot, logger zap.SugaredLogger) {
+	if listener, ok := collector.Collector.(Listener); ok {
+		err := listener.Listen(ctx)
+		if err != nil {
+			logger.Errorln("Error while starting listener of "+collector.Collector.Name()+": ", err)
+			return
+		}
+	}
+
+	ticker := time.NewTicker(collector.Interval)
+	defer ticker.Stop()
+	for {
+		metrics, err := collector.Collector.Collect(ctx)
+		if err != nil {
+			logger.Errorln("Error while collecting metrics by "+collector.Collector.Name()+": ", err)
+		}
+		snapshot.AddFrom(collector.Collector.Name(), metrics)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Snapshot - data type to describe metrics, that were collected, but not sent to server yet.
+type Snapshot struct {
+	mutex    sync.Mutex
+	gauges   map[string]data.Metrics
+	counters map[string]data.Metrics
+	sources  map[string]map[string]struct{}
+}
+
+// AddFrom - function for adding metrics, collected by source, to snapshot.
+// Gauges, which source reported previously, but did not report now, are removed,
+// so that series of disappeared objects, such as finished processes, are not sent anymore.
+func (s *Snapshot) AddFrom(source string, metrics []data.Metrics) {
+	keys := make(map[string]struct{}, len(metrics))
+	for _, metric := range metrics {
+		if metric.MType == "gauge" {
+			keys[metric.Key()] = struct{}{}
+		}
+	}
+
+	s.mutex.Lock()
+	if s.sources == nil {
+		s.sources = make(map[string]map[string]struct{})
+	}
+	for key := range s.sources[source] {
+		if _, ok := keys[key]; !ok {
+			delete(s.gauges, key)
+		}
+	}
+	s.sources[source] = keys
+	s.mutex.Unlock()
+
+	s.Add(metrics)
+}
+
+// Add - function for adding collected metrics to snapshot.
+func (s *Snapshot) Add(metrics []data.Metrics) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.gauges == nil {
+		s.gauges = make(map[string]data.Metrics)
+		s.counters = make(map[string]data.Metrics)
+	}
+
+	for _, metric := range metrics {
+		switch {
+		case metric.MType == "gauge" && metric.Value != nil:
+			value := *metric.Value
+			metric.Value = &value
+			s.gauges[metric.Key()] = metric
+		case metric.MType == "counter" && metric.Delta != nil:
+			delta := *metric.Delta
+			if current, ok := s.counters[metric.Key()]; ok {
+				delta += *current.Delta
+			}
+			metric.Delta = &delta
+			s.counters[metric.Key()] = metric
+		}
+	}
+}
+
+// Take - function, that returns last values of gauges and collected deltas of counters.
+// Deltas of counters are removed from snapshot, they must be returned with Return, if metrics were not sent.
+func (s *Snapshot) Take() []data.Metrics {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	metrics := make([]data.Metrics, 0, len(s.gauges)+len(s.counters))
+	for _, metric := range s.gauges {
+		value := *metric.Value
+		metric.Value = &value
+		metrics = append(metrics, metric)
+	}
+	for _, metric := range s.counters {
+		metrics = append(metrics, metric)
+	}
+	s.counters = make(map[string]data.Metrics)
+
+	return metrics
+}
+
+// Return - function for returning deltas of counters, that were not sent, to snapshot.
+func (s *Snapshot) Return(metrics []data.Metrics) {
+	counters := make([]data.Metrics, 0, len(metrics))
+	for _, metric := range metrics {
+		if metric.MType == "counter" {
+			counters = append(counters, metric)
+		}
+	}
+
+	s.Add(counters)
+}
+
+// matchFilter - function, that checks value with include and exclude glob patterns.
+// Empty include list means, that all values are included.
+func matchFilter(value string, include []string, exclude []string) bool {
+	matches := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, value); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(include) != 0 && !matches(include) {
+		return false
+	}
+
+	return !matches(exclude)
+}
+
+// deltaTracker - data type to describe conversion of cumulative values to deltas of counters.
+type deltaTracker struct {
+	previous map[string]uint64
+}
+
+// Delta - function, that returns increase of cumulative value since the previous call.
+// The first value of series is only remembered, decreased value means that source was reset.
+func (d *deltaTracker) Delta(key string, value uint64) (int64, bool) {
+	if d.previous == nil {
+		d.previous = make(map[string]uint64)
+	}
+
+	previous, ok := d.previous[key]
+	d.previous[key] = value
+	if !ok {
+		return 0, false
+	}
+	if value < previous {
+		return int64(value), true
+	}
+
+	return int64(value - previous), true
+}
+
+// gaugeMetric - function, that makes gauge with labels.
+func gaugeMetric(name string, value float64, labels map[string]string) data.Metrics {
+	return data.Metrics{ID: name, MType: "gauge", Value: &value, Labels: labels}
+}
+
+// counterMetric - function, that makes counter with labels.
+func counterMetric(name string, delta int64, labels map[string]string) data.Metrics {
+	return data.Metrics{ID: name, MType: "counter", Delta: &delta, Labels: labels}
+}
+
+// isFinite - function, that checks, that value is neither NaN nor infinity, which can not be serialized to JSON.
+func isFinite(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// CgroupCollectorName - name of collector of cgroup v2 metrics.
+const CgroupCollectorName = "cgroup"
+
+// CgroupRoot - mount point of cgroup v2 filesystem.
+const CgroupRoot = "/sys/fs/cgroup"
+
+func init() {
+	RegisterCollector(CgroupCollectorName, false, func(config data.CollectorConfig) (Collector, error) {
+		cgroupPath := config.CgroupPath
+		if cgroupPath == "" {
+			content, err := os.ReadFile("/proc/self/cgroup")
+			if err != nil {
+				return nil, fmt.Errorf("error while reading cgroup of agent: %w", err)
+			}
+			cgroupPath, err = parseSelfCgroup(content)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &CgroupCollector{Root: CgroupRoot, Path: cgroupPath}, nil
+	})
+}
+
+// parseSelfCgroup - function, that finds path of cgroup v2 in content of /proc/self/cgroup.
+func parseSelfCgroup(content []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("cgroup v2 is not used by agent")
+}
+
+// CgroupCollector - collector, that gets cpu, memory, input/output and pids usage of cgroup v2.
+// Missing files of disabled controllers are skipped.
+type CgroupCollector struct {
+	Root      string // Mount point of cgroup v2 filesystem
+	Path      string // Path of cgroup relative to mount point
+	deltas    deltaTracker
+	lastUsage uint64
+	lastTime  time.Time
+}
+
+// Name - function, that returns name of collector.
+func (c *CgroupCollector) Name() string {
+	return CgroupCollectorName
+}
+
+// Collect - function, that collects metrics from files of cgroup.
+// Metrics, that were collected successfully, are returned together with errors.
+func (c *CgroupCollector) Collect(ctx context.Context) ([]data.Metrics, error) {
+	metrics := make([]data.Metrics, 0)
+	var errs []error
+	labels := map[string]string{"cgroup": c.Path}
+	now := time.Now()
+
+	cpuStat, err := c.readKeyValues("cpu.stat")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for key, metricName := range map[string]string{
+		"usage_usec":     "CgroupCPUUsageUsec",
+		"user_usec":      "CgroupCPUUserUsec",
+		"system_usec":    "CgroupCPUSystemUsec",
+		"nr_periods":     "CgroupCPUPeriods",
+		"nr_throttled":   "CgroupCPUThrottledPeriods",
+		"throttled_usec": "CgroupCPUThrottledUsec",
+	} {
+		if value, ok := cpuStat[key]; ok {
+			metrics = c.appendCounter(metrics, metricName, "", value, labels)
+		}
+	}
+	// utilization is measured in percent of one cpu, as cpu.Percent measures every cpu
+	if usage, ok := cpuStat["usage_usec"]; ok {
+		if !c.lastTime.IsZero() && usage >= c.lastUsage {
+			elapsed := now.Sub(c.lastTime).Microseconds()
+			if elapsed > 0 {
+				metrics = append(metrics, gaugeMetric("CgroupCPUPercent", float64(usage-c.lastUsage)/float64(elapsed)*100, labels))
+			}
+		}
+		c.lastUsage = usage
+		c.lastTime = now
+	}
+
+	memoryUsage, okUsage, err := c.readValue("memory.current")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if okUsage {
+		metrics = append(metrics, gaugeMetric("CgroupMemoryUsage", float64(memoryUsage), labels))
+	}
+	memoryLimit, okLimit, err := c.readValue("memory.max")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if okLimit {
+		metrics = append(metrics, gaugeMetric("CgroupMemoryLimit", float64(memoryLimit), labels))
+		if okUsage && memoryLimit != 0 {
+			metrics = append(metrics, gaugeMetric("CgroupMemoryUsagePercent", float64(memoryUsage)/float64(memoryLimit)*100, labels))
+		}
+	}
+
+	memoryEvents, err := c.readKeyValues("memory.events")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for key, metricName := range map[string]string{
+		"oom":      "CgroupOOMEvents",
+		"oom_kill": "CgroupOOMKills",
+	} {
+		if value, ok := memoryEvents[key]; ok {
+			metrics = c.appendCounter(metrics, metricName, "", value, labels)
+		}
+	}
+
+	ioStat, err := c.readIOStat()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for device, values := range ioStat {
+		deviceLabels := map[string]string{"cgroup": c.Path, "device": device}
+		for key, metricName := range map[string]string{
+			"rbytes": "CgroupIOReadBytes",
+			"wbytes": "CgroupIOWriteBytes",
+			"rios":   "CgroupIOReadOps",
+			"wios":   "CgroupIOWriteOps",
+		} {
+			if value, ok := values[key]; ok {
+				metrics = c.appendCounter(metrics, metricName, device, value, deviceLabels)
+			}
+		}
+	}
+
+	pids, ok, err := c.readValue("pids.current")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if ok {
+		metrics = append(metrics, gaugeMetric("CgroupPids", float64(pids), labels))
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// appendCounter - function, that converts cumulative value of cgroup to delta of counter and adds it to metrics.
+func (c *CgroupCollector) appendCounter(metrics []data.Metrics, metricName string, device string, value uint64, labels map[string]string) []data.Metrics {
+	if delta, ok := c.deltas.Delta(metricName+"/"+device, value); ok {
+		metrics = append(metrics, counterMetric(metricName, delta, labels))
+	}
+
+	return metrics
+}
+
+// readFile - function, that reads file of cgroup. Missing file is not an error.
+func (c *CgroupCollector) readFile(name string) ([]byte, bool, error) {
+	content, err := os.ReadFile(filepath.Join(c.Root, c.Path, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error while reading %s: %w", name, err)
+	}
+
+	return content, true, nil
+}
+
+// readValue - function, that reads file of cgroup with one value. Value "max" means, that there is no limit.
+func (c *CgroupCollector) readValue(name string) (uint64, bool, error) {
+	content, ok, err := c.readFile(name)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	text := strings.TrimSpace(string(content))
+	if text == "max" {
+		return 0, false, nil
+	}
+	value, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid value of %s: %w", name, err)
+	}
+
+	return value, true, nil
+}
+
+// readKeyValues - function, that reads file of cgroup with lines in form "key value".
+func (c *CgroupCollector) readKeyValues(name string) (map[string]uint64, error) {
+	content, ok, err := c.readFile(name)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s in %s: %w", fields[0], name, err)
+		}
+		values[fields[0]] = value
+	}
+
+	return values, nil
+}
+
+// readIOStat - function, that reads io.stat of cgroup with lines in form "major:minor key=value ...".
+func (c *CgroupCollector) readIOStat() (map[string]map[string]uint64, error) {
+	content, ok, err := c.readFile("io.stat")
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	devices := make(map[string]map[string]uint64)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		values := make(map[string]uint64)
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			number, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of %s in io.stat: %w", key, err)
+			}
+			values[key] = number
+		}
+		devices[fields[0]] = values
+	}
+
+	return devices, nil
+}
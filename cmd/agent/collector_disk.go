@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/shirou/gopsutil/v4/disk"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// DiskCollectorName - name of collector of disk and filesystem metrics.
+const DiskCollectorName = "disk"
+
+// defaultExcludeFSTypes - types of virtual filesystems, which are skipped by default.
+var defaultExcludeFSTypes = []string{"tmpfs", "devtmpfs", "overlay", "squashfs", "proc", "sysfs", "cgroup", "cgroup2", "devpts", "mqueue", "autofs", "nsfs", "tracefs", "debugfs"}
+
+func init() {
+	RegisterCollector(DiskCollectorName, false, func(config data.CollectorConfig) (Collector, error) {
+		collector := &DiskCollector{
+			IncludeMounts:  config.Include,
+			ExcludeMounts:  config.Exclude,
+			IncludeFSTypes: config.IncludeFSTypes,
+			ExcludeFSTypes: config.ExcludeFSTypes,
+			partitions:     disk.PartitionsWithContext,
+			usage:          disk.UsageWithContext,
+			ioCounters:     disk.IOCountersWithContext,
+		}
+		if collector.ExcludeFSTypes == nil {
+			collector.ExcludeFSTypes = defaultExcludeFSTypes
+		}
+		return collector, nil
+	})
+}
+
+// DiskCollector - collector, that gets usage of mounted filesystems and input/output statistics of devices.
+// Usage is reported with mountpoint, device and fstype labels, statistics of devices are reported with device label.
+// Statistics are reported only for devices of partitions, that match filters of mount points and filesystem types.
+type DiskCollector struct {
+	IncludeMounts  []string // Patterns of mount points for reporting, all mount points by default
+	ExcludeMounts  []string // Patterns of mount points, which are skipped
+	IncludeFSTypes []string // Patterns of filesystem types for reporting, all types by default
+	ExcludeFSTypes []string // Patterns of filesystem types, which are skipped
+	partitions     func(ctx context.Context, all bool) ([]disk.PartitionStat, error)
+	usage          func(ctx context.Context, path string) (*disk.UsageStat, error)
+	ioCounters     func(ctx context.Context, names ...string) (map[string]disk.IOCountersStat, error)
+	deltas         deltaTracker
+}
+
+// Name - function, that returns name of collector.
+func (c *DiskCollector) Name() string {
+	return DiskCollectorName
+}
+
+// Collect - function, that collects usage of filesystems and input/output statistics of devices.
+// Metrics, that were collected successfully, are returned together with errors.
+func (c *DiskCollector) Collect(ctx context.Context) ([]data.Metrics, error) {
+	metrics := make([]data.Metrics, 0)
+	var errs []error
+
+	partitions, err := c.partitions(ctx, false)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error while getting partitions: %w", err))
+	}
+	devices := make([]string, 0, len(partitions))
+	for _, partition := range partitions {
+		if !matchFilter(partition.Mountpoint, c.IncludeMounts, c.ExcludeMounts) || !matchFilter(partition.Fstype, c.IncludeFSTypes, c.ExcludeFSTypes) {
+			continue
+		}
+		devices = append(devices, deviceName(partition.Device))
+
+		usage, err := c.usage(ctx, partition.Mountpoint)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error while getting usage of %s: %w", partition.Mountpoint, err))
+			continue
+		}
+
+		labels := map[string]string{"mountpoint": partition.Mountpoint, "device": partition.Device, "fstype": partition.Fstype}
+		metrics = append(metrics,
+			gaugeMetric("DiskTotalBytes", float64(usage.Total), labels),
+			gaugeMetric("DiskUsedBytes", float64(usage.Used), labels),
+			gaugeMetric("DiskFreeBytes", float64(usage.Free), labels),
+			gaugeMetric("DiskInodesTotal", float64(usage.InodesTotal), labels),
+			gaugeMetric("DiskInodesUsed", float64(usage.InodesUsed), labels),
+			gaugeMetric("DiskInodesFree", float64(usage.InodesFree), labels),
+		)
+	}
+
+	// without names statistics of all devices are returned
+	if len(devices) == 0 {
+		return metrics, errors.Join(errs...)
+	}
+	ioCounters, err := c.ioCounters(ctx, devices...)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error while getting input/output statistics: %w", err))
+	}
+	for device, counters := range ioCounters {
+		labels := map[string]string{"device": device}
+		for metricName, value := range map[string]uint64{
+			"DiskReadBytes":  counters.ReadBytes,
+			"DiskWriteBytes": counters.WriteBytes,
+			"DiskReadOps":    counters.ReadCount,
+			"DiskWriteOps":   counters.WriteCount,
+		} {
+			if delta, ok := c.deltas.Delta(metricName+"/"+device, value); ok {
+				metrics = append(metrics, counterMetric(metricName, delta, labels))
+			}
+		}
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// deviceName - function, that returns name of block device of partition, as it is named in input/output statistics.
+// Links, such as /dev/mapper/root, are resolved to devices, which they point to.
+func deviceName(device string) string {
+	path, err := filepath.EvalSymlinks(device)
+	if err == nil {
+		device = path
+	}
+
+	return filepath.Base(device)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// ExecCollectorName - name of collector of metrics from scripts.
+const ExecCollectorName = "exec"
+
+// Formats of script output.
+const (
+	ScriptFormatJSON = "json" // JSON array of metrics, as in body of /updates/ request
+	ScriptFormatText = "text" // Lines in form "name type value"
+)
+
+// DefaultScriptTimeout - default time duration for running script.
+const DefaultScriptTimeout = 10 * time.Second
+
+func init() {
+	RegisterCollector(ExecCollectorName, false, func(config data.CollectorConfig) (Collector, error) {
+		return NewExecCollector(config.Scripts)
+	})
+}
+
+// script - data type to describe validated script.
+type script struct {
+	data.ScriptConfig
+	timeout time.Duration
+}
+
+// ExecCollector - collector, that runs scripts and parses their output as metrics.
+// Scripts are run concurrently, error of one script does not affect other scripts.
+// Every script reports its exit code and duration of run with script label.
+type ExecCollector struct {
+	scripts []script
+}
+
+// NewExecCollector - function, that validates scripts and creates collector of their metrics.
+func NewExecCollector(scripts []data.ScriptConfig) (*ExecCollector, error) {
+	if len(scripts) == 0 {
+		return nil, fmt.Errorf("scripts are not set")
+	}
+
+	collector := &ExecCollector{}
+	names := make(map[string]struct{}, len(scripts))
+	for _, config := range scripts {
+		if config.Name == "" {
+			return nil, fmt.Errorf("name of script is empty")
+		}
+		if _, ok := names[config.Name]; ok {
+			return nil, fmt.Errorf("script %s is defined more than once", config.Name)
+		}
+		names[config.Name] = struct{}{}
+
+		if len(config.Command) == 0 {
+			return nil, fmt.Errorf("command of script %s is empty", config.Name)
+		}
+		if config.Format != "" && config.Format != ScriptFormatJSON && config.Format != ScriptFormatText {
+			return nil, fmt.Errorf("invalid format of script %s: %s", config.Name, config.Format)
+		}
+
+		compiled := script{ScriptConfig: config, timeout: DefaultScriptTimeout}
+		if config.Timeout != "" {
+			seconds, err := strconv.Atoi(strings.Split(config.Timeout, "s")[0])
+			if err != nil || seconds <= 0 {
+				return nil, fmt.Errorf("invalid timeout of script %s: %s", config.Name, config.Timeout)
+			}
+			compiled.timeout = time.Duration(seconds) * time.Second
+		}
+		collector.scripts = append(collector.scripts, compiled)
+	}
+
+	return collector, nil
+}
+
+// Name - function, that returns name of collector.
+func (c *ExecCollector) Name() string {
+	return ExecCollectorName
+}
+
+// Collect - function, that runs all scripts and collects their metrics.
+func (c *ExecCollector) Collect(ctx context.Context) ([]data.Metrics, error) {
+	results := make([][]data.Metrics, len(c.scripts))
+	errs := make([]error, len(c.scripts))
+
+	var wg sync.WaitGroup
+	for i := range c.scripts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = c.scripts[i].run(ctx)
+		}()
+	}
+	wg.Wait()
+
+	metrics := make([]data.Metrics, 0)
+	for _, result := range results {
+		metrics = append(metrics, result...)
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// run - function, that runs script with timeout and parses its output.
+// Self-metrics of script are returned even if script failed.
+func (s *script) run(ctx context.Context) ([]data.Metrics, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Stdout = &stdout
+	// child processes of script can keep output open after script is killed
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	duration := time.Since(start)
+
+	labels := map[string]string{"script": s.Name}
+	exitCode := -1
+	if cmd.ProcessState != nil {
+		exitCode = cmd.ProcessState.ExitCode()
+	}
+	metrics := []data.Metrics{
+		gaugeMetric("ScriptExitCode", float64(exitCode), labels),
+		gaugeMetric("ScriptDuration", duration.Seconds(), labels),
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return metrics, fmt.Errorf("script %s exceeded timeout %s", s.Name, s.timeout)
+	}
+	if err != nil {
+		return metrics, fmt.Errorf("error while running script %s: %w", s.Name, err)
+	}
+
+	parsed, err := parseScriptOutput(stdout.Bytes(), s.Format)
+	if err != nil {
+		return metrics, fmt.Errorf("error while parsing output of script %s: %w", s.Name, err)
+	}
+
+	return append(parsed, metrics...), nil
+}
+
+// parseScriptOutput - function, that parses output of script in JSON or text format.
+// If format is empty, output, which starts with "[", is parsed as JSON.
+func parseScriptOutput(output []byte, format string) ([]data.Metrics, error) {
+	if format == "" {
+		format = ScriptFormatText
+		if bytes.HasPrefix(bytes.TrimSpace(output), []byte("[")) {
+			format = ScriptFormatJSON
+		}
+	}
+
+	var metrics []data.Metrics
+	if format == ScriptFormatJSON {
+		err := json.Unmarshal(output, &metrics)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(output))
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			metric, err := parseMetricLine(text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			metrics = append(metrics, metric)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, metric := range metrics {
+		if metric.ID == "" {
+			return nil, fmt.Errorf("metric name is empty")
+		}
+		if (metric.MType != "gauge" || metric.Value == nil) && (metric.MType != "counter" || metric.Delta == nil) {
+			return nil, fmt.Errorf("invalid type or value of metric %s", metric.ID)
+		}
+		if metric.Value != nil && !isFinite(*metric.Value) {
+			return nil, fmt.Errorf("value of metric %s is not finite", metric.ID)
+		}
+	}
+
+	return metrics, nil
+}
+
+// parseMetricLine - function, that parses metric from line in form "name type value".
+// Value of counter is increase since the previous run of script.
+func parseMetricLine(line string) (data.Metrics, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return data.Metrics{}, fmt.Errorf("expected \"name type value\", got %q", line)
+	}
+
+	switch fields[1] {
+	case "gauge":
+		value, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return data.Metrics{}, err
+		}
+		if !isFinite(value) {
+			return data.Metrics{}, fmt.Errorf("value of metric %s is not finite: %s", fields[0], fields[2])
+		}
+		return gaugeMetric(fields[0], value, nil), nil
+	case "counter":
+		delta, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return data.Metrics{}, err
+		}
+		return counterMetric(fields[0], delta, nil), nil
+	}
+
+	return data.Metrics{}, fmt.Errorf("invalid type of metric %s: %s", fields[0], fields[1])
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"math"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// GoCollectorName - name of collector of metrics from runtime/metrics package.
+const GoCollectorName = "go"
+
+func init() {
+	RegisterCollector(GoCollectorName, true, func(config data.CollectorConfig) (Collector, error) {
+		return NewGoCollector(), nil
+	})
+}
+
+// GoCollector - collector, that gets all supported metrics from runtime/metrics package without stopping the world.
+// Cumulative integer metrics are reported as counters, other scalar metrics are reported as gauges.
+// Histograms are reported as gauges with quantile label, calculated from observations since the previous collection,
+// and counter of observations with "_count" suffix.
+type GoCollector struct {
+	samples   []metrics.Sample
+	cumulate  map[string]bool
+	deltas    deltaTracker
+	previous  map[string][]uint64
+	quantiles map[string][]float64
+}
+
+// NewGoCollector - function, that creates collector for all metrics, supported by runtime.
+func NewGoCollector() *GoCollector {
+	descriptions := metrics.All()
+	collector := &GoCollector{
+		samples:   make([]metrics.Sample, 0, len(descriptions)),
+		cumulate:  make(map[string]bool, len(descriptions)),
+		previous:  make(map[string][]uint64),
+		quantiles: make(map[string][]float64),
+	}
+	for _, description := range descriptions {
+		collector.samples = append(collector.samples, metrics.Sample{Name: description.Name})
+		collector.cumulate[description.Name] = description.Cumulative
+	}
+
+	return collector
+}
+
+// Name - function, that returns name of collector.
+func (c *GoCollector) Name() string {
+	return GoCollectorName
+}
+
+// Collect - function, that reads all samples of runtime/metrics package.
+func (c *GoCollector) Collect(ctx context.Context) ([]data.Metrics, error) {
+	metrics.Read(c.samples)
+
+	result := make([]data.Metrics, 0, len(c.samples))
+	for _, sample := range c.samples {
+		// names, such as "/gc/heap/allocs:bytes", are sanitized as in Prometheus exposition of server
+		name := "go_" + data.SanitizePrometheusName(strings.TrimPrefix(sample.Name, "/"))
+
+		switch sample.Value.Kind() {
+		case metrics.KindUint64:
+			value := sample.Value.Uint64()
+			if !c.cumulate[sample.Name] {
+				result = append(result, gaugeMetric(name, float64(value), nil))
+			} else if delta, ok := c.deltas.Delta(name, value); ok {
+				result = append(result, counterMetric(name, delta, nil))
+			}
+		case metrics.KindFloat64:
+			result = append(result, gaugeMetric(name, sample.Value.Float64(), nil))
+		case metrics.KindFloat64Histogram:
+			result = append(result, c.histogramMetrics(name, sample.Value.Float64Histogram())...)
+		}
+	}
+
+	return result, nil
+}
+
+// histogramMetrics - function, that converts histogram to quantile gauges and counter of observations.
+// If there were no observations since the previous collection, the previous quantiles are reported.
+func (c *GoCollector) histogramMetrics(name string, histogram *metrics.Float64Histogram) []data.Metrics {
+	counts := histogram.Counts
+	previous := c.previous[name]
+	c.previous[name] = append([]uint64(nil), counts...)
+
+	window := make([]uint64, len(counts))
+	var total uint64
+	for i, count := range counts {
+		window[i] = count
+		if len(previous) == len(counts) && count >= previous[i] {
+			window[i] = count - previous[i]
+		}
+		total += window[i]
+	}
+
+	if total != 0 {
+		quantiles := make([]float64, len(reportedQuantiles))
+		for i, q := range reportedQuantiles {
+			quantiles[i] = histogramQuantile(window, histogram.Buckets, q)
+		}
+		c.quantiles[name] = quantiles
+	}
+
+	result := make([]data.Metrics, 0, len(reportedQuantiles)+1)
+	for i, value := range c.quantiles[name] {
+		result = append(result, gaugeMetric(name, value, map[string]string{"quantile": strconv.FormatFloat(reportedQuantiles[i], 'f', -1, 64)}))
+	}
+	if previous != nil {
+		result = append(result, counterMetric(name+"_count", int64(total), nil))
+	}
+
+	return result
+}
+
+// histogramQuantile - function, that estimates quantile of histogram as upper boundary of bucket, which contains quantile.
+// Buckets contain boundaries of counts, so len(buckets) is equal to len(counts)+1.
+func histogramQuantile(counts []uint64, buckets []float64, q float64) float64 {
+	var total uint64
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	var cumulative uint64
+	for i, count := range counts {
+		cumulative += count
+		if cumulative < rank {
+			continue
+		}
+		if math.IsInf(buckets[i+1], 1) {
+			return buckets[i]
+		}
+		return buckets[i+1]
+	}
+
+	return buckets[len(buckets)-1]
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shirou/gopsutil/v4/net"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// NetCollectorName - name of collector of network metrics.
+const NetCollectorName = "net"
+
+// ProcRoot - mount point of proc filesystem.
+const ProcRoot = "/proc"
+
+// defaultExcludeInterfaces - patterns of network interfaces, which are skipped by default.
+var defaultExcludeInterfaces = []string{"lo", "veth*"}
+
+// tcpStates - states of TCP connections, that are reported by collector.
+// All states are reported every time, so that gauge of state without connections becomes zero.
+var tcpStates = []string{"ESTABLISHED", "SYN_SENT", "SYN_RECV", "FIN_WAIT1", "FIN_WAIT2", "TIME_WAIT", "CLOSE", "CLOSE_WAIT", "LAST_ACK", "LISTEN", "CLOSING"}
+
+// tcpStateCodes - states of TCP connections by their hex codes in /proc/net/tcp.
+var tcpStateCodes = map[string]string{
+	"01": "ESTABLISHED", "02": "SYN_SENT", "03": "SYN_RECV", "04": "FIN_WAIT1", "05": "FIN_WAIT2", "06": "TIME_WAIT",
+	"07": "CLOSE", "08": "CLOSE_WAIT", "09": "LAST_ACK", "0A": "LISTEN", "0B": "CLOSING",
+}
+
+func init() {
+	RegisterCollector(NetCollectorName, false, func(config data.CollectorConfig) (Collector, error) {
+		collector := &NetCollector{
+			IncludeInterfaces: config.Include,
+			ExcludeInterfaces: config.Exclude,
+			ProcRoot:          ProcRoot,
+			ioCounters:        net.IOCountersWithContext,
+		}
+		if collector.ExcludeInterfaces == nil {
+			collector.ExcludeInterfaces = defaultExcludeInterfaces
+		}
+		return collector, nil
+	})
+}
+
+// NetCollector - collector, that gets traffic statistics of network interfaces and number of TCP connections.
+// Statistics are reported as counters with interface label, connections are reported as gauges with state label.
+// Connections are counted from /proc/net/tcp and /proc/net/tcp6 without resolving processes, that own them.
+type NetCollector struct {
+	IncludeInterfaces []string // Patterns of interfaces for reporting, all interfaces by default
+	ExcludeInterfaces []string // Patterns of interfaces, which are skipped
+	ProcRoot          string   // Mount point of proc filesystem
+	ioCounters        func(ctx context.Context, pernic bool) ([]net.IOCountersStat, error)
+	deltas            deltaTracker
+}
+
+// Name - function, that returns name of collector.
+func (c *NetCollector) Name() string {
+	return NetCollectorName
+}
+
+// Collect - function, that collects statistics of network interfaces and TCP connections.
+// Metrics, that were collected successfully, are returned together with errors.
+func (c *NetCollector) Collect(ctx context.Context) ([]data.Metrics, error) {
+	metrics := make([]data.Metrics, 0)
+	var errs []error
+
+	ioCounters, err := c.ioCounters(ctx, true)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error while getting statistics of network interfaces: %w", err))
+	}
+	for _, counters := range ioCounters {
+		if !matchFilter(counters.Name, c.IncludeInterfaces, c.ExcludeInterfaces) {
+			continue
+		}
+
+		labels := map[string]string{"interface": counters.Name}
+		for metricName, value := range map[string]uint64{
+			"NetBytesSent":   counters.BytesSent,
+			"NetBytesRecv":   counters.BytesRecv,
+			"NetPacketsSent": counters.PacketsSent,
+			"NetPacketsRecv": counters.PacketsRecv,
+			"NetErrorsIn":    counters.Errin,
+			"NetErrorsOut":   counters.Errout,
+			"NetDropsIn":     counters.Dropin,
+			"NetDropsOut":    counters.Dropout,
+		} {
+			if delta, ok := c.deltas.Delta(metricName+"/"+counters.Name, value); ok {
+				metrics = append(metrics, counterMetric(metricName, delta, labels))
+			}
+		}
+	}
+
+	states, err := countTCPStates(c.ProcRoot)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error while getting TCP connections: %w", err))
+		return metrics, errors.Join(errs...)
+	}
+	for _, state := range tcpStates {
+		metrics = append(metrics, gaugeMetric("NetTCPConnections", float64(states[state]), map[string]string{"state": state}))
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// countTCPStates - function, that counts TCP connections by states in tcp and tcp6 tables of proc filesystem.
+// Missing tcp6 table, when IPv6 is disabled, is skipped.
+func countTCPStates(procRoot string) (map[string]int, error) {
+	states := make(map[string]int, len(tcpStates))
+	for _, table := range []string{"tcp", "tcp6"} {
+		content, err := os.ReadFile(filepath.Join(procRoot, "net", table))
+		if err != nil {
+			if table == "tcp6" && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		// the first line is header of table
+		scanner.Scan()
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 {
+				continue
+			}
+			if state, ok := tcpStateCodes[strings.ToUpper(fields[3])]; ok {
+				states[state]++
+			}
+		}
+	}
+
+	return states, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// ProcessCollectorName - name of collector of process metrics.
+const ProcessCollectorName = "process"
+
+func init() {
+	RegisterCollector(ProcessCollectorName, false, func(config data.CollectorConfig) (Collector, error) {
+		return NewProcessCollector(config.Processes)
+	})
+}
+
+// processMatcher - data type to describe validated matcher of processes.
+type processMatcher struct {
+	data.ProcessMatcher
+	cmdline *regexp.Regexp
+}
+
+// ProcessCollector - collector, that gets resource usage of processes, found by matchers.
+// Every matched process is reported as separate series with process and pid labels.
+type ProcessCollector struct {
+	matchers  []processMatcher
+	processes map[int32]*process.Process
+}
+
+// NewProcessCollector - function, that validates matchers and creates collector of process metrics.
+func NewProcessCollector(matchers []data.ProcessMatcher) (*ProcessCollector, error) {
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("process matchers are not set")
+	}
+
+	collector := &ProcessCollector{processes: make(map[int32]*process.Process)}
+	names := make(map[string]struct{}, len(matchers))
+	for _, matcher := range matchers {
+		if matcher.Name == "" {
+			return nil, fmt.Errorf("name of process matcher is empty")
+		}
+		if _, ok := names[matcher.Name]; ok {
+			return nil, fmt.Errorf("process matcher %s is defined more than once", matcher.Name)
+		}
+		names[matcher.Name] = struct{}{}
+
+		set := 0
+		for _, value := range []string{matcher.Process, matcher.Cmdline, matcher.Pidfile} {
+			if value != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("process matcher %s must have exactly one of process, cmdline or pidfile", matcher.Name)
+		}
+
+		compiled := processMatcher{ProcessMatcher: matcher}
+		if matcher.Cmdline != "" {
+			var err error
+			compiled.cmdline, err = regexp.Compile(matcher.Cmdline)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cmdline of process matcher %s: %w", matcher.Name, err)
+			}
+		}
+		collector.matchers = append(collector.matchers, compiled)
+	}
+
+	return collector, nil
+}
+
+// Name - function, that returns name of collector.
+func (c *ProcessCollector) Name() string {
+	return ProcessCollectorName
+}
+
+// Collect - function, that collects RSS, cpu utilization, number of open files and threads and uptime of matched processes.
+// Number of matched processes is reported for every matcher, so that absence of process can be noticed.
+func (c *ProcessCollector) Collect(ctx context.Context) ([]data.Metrics, error) {
+	metrics := make([]data.Metrics, 0)
+	var errs []error
+
+	pids, err := process.PidsWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting list of processes: %w", err)
+	}
+
+	alive := make(map[int32]*process.Process, len(pids))
+	for _, pid := range pids {
+		proc, ok := c.processes[pid]
+		if !ok {
+			proc, err = process.NewProcessWithContext(ctx, pid)
+			if err != nil {
+				continue
+			}
+		}
+		alive[pid] = proc
+	}
+	// processes are kept between collections, because cpu utilization is calculated from the previous call
+	c.processes = alive
+
+	for _, matcher := range c.matchers {
+		matched, err := c.match(ctx, matcher)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error while matching processes %s: %w", matcher.Name, err))
+		}
+
+		metrics = append(metrics, gaugeMetric("ProcessCount", float64(len(matched)), map[string]string{"process": matcher.Name}))
+		for _, proc := range matched {
+			labels := map[string]string{"process": matcher.Name, "pid": strconv.Itoa(int(proc.Pid))}
+			metrics = append(metrics, processMetrics(ctx, proc, labels)...)
+		}
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// match - function, that returns running processes, found by matcher.
+func (c *ProcessCollector) match(ctx context.Context, matcher processMatcher) ([]*process.Process, error) {
+	if matcher.Pidfile != "" {
+		content, err := os.ReadFile(matcher.Pidfile)
+		if err != nil {
+			return nil, err
+		}
+		pid, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pidfile %s: %w", matcher.Pidfile, err)
+		}
+		if proc, ok := c.processes[int32(pid)]; ok {
+			return []*process.Process{proc}, nil
+		}
+		return nil, nil
+	}
+
+	matched := make([]*process.Process, 0)
+	for _, proc := range c.processes {
+		if matcher.Process != "" {
+			name, err := proc.NameWithContext(ctx)
+			if err == nil && name == matcher.Process {
+				matched = append(matched, proc)
+			}
+			continue
+		}
+
+		cmdline, err := proc.CmdlineWithContext(ctx)
+		if err == nil && matcher.cmdline.MatchString(cmdline) {
+			matched = append(matched, proc)
+		}
+	}
+
+	return matched, nil
+}
+
+// processMetrics - function, that collects metrics of one process.
+// Process can finish during collection, so metrics, that can not be read, are skipped.
+func processMetrics(ctx context.Context, proc *process.Process, labels map[string]string) []data.Metrics {
+	metrics := make([]data.Metrics, 0, 5)
+
+	if memInfo, err := proc.MemoryInfoWithContext(ctx); err == nil {
+		metrics = append(metrics, gaugeMetric("ProcessRSS", float64(memInfo.RSS), labels))
+	}
+	if percent, err := proc.PercentWithContext(ctx, 0); err == nil {
+		metrics = append(metrics, gaugeMetric("ProcessCPUPercent", percent, labels))
+	}
+	if fds, err := proc.NumFDsWithContext(ctx); err == nil {
+		metrics = append(metrics, gaugeMetric("ProcessOpenFDs", float64(fds), labels))
+	}
+	if threads, err := proc.NumThreadsWithContext(ctx); err == nil {
+		metrics = append(metrics, gaugeMetric("ProcessThreads", float64(threads), labels))
+	}
+	if createTime, err := proc.CreateTimeWithContext(ctx); err == nil {
+		metrics = append(metrics, gaugeMetric("ProcessUptime", time.Since(time.UnixMilli(createTime)).Seconds(), labels))
+	}
+
+	return metrics
+}
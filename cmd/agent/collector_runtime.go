@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// RuntimeCollectorName - name of collector of runtime metrics.
+const RuntimeCollectorName = "runtime"
+
+func init() {
+	RegisterCollector(RuntimeCollectorName, true, func(config data.CollectorConfig) (Collector, error) {
+		return &RuntimeCollector{}, nil
+	})
+}
+
+// RuntimeCollector - collector, that gets memory statistics from runtime library, random value and number of polls.
+type RuntimeCollector struct{}
+
+// Name - function, that returns name of collector.
+func (c *RuntimeCollector) Name() string {
+	return RuntimeCollectorName
+}
+
+// Collect - function, that collects all metrics from runtime library.
+func (c *RuntimeCollector) Collect(ctx context.Context) ([]data.Metrics, error) {
+	var memStats runtime.MemStats
+	mapMetrics := make(map[string]float64)
+
+	runtime.ReadMemStats(&memStats)
+	mapMetrics["Alloc"] = float64(memStats.Alloc)
+	mapMetrics["BuckHashSys"] = float64(memStats.BuckHashSys)
+	mapMetrics["Frees"] = float64(memStats.Frees)
+	mapMetrics["GCCPUFraction"] = float64(memStats.GCCPUFraction)
+	mapMetrics["GCSys"] = float64(memStats.GCSys)
+	mapMetrics["HeapAlloc"] = float64(memStats.HeapAlloc)
+	mapMetrics["HeapIdle"] = float64(memStats.HeapIdle)
+	mapMetrics["HeapInuse"] = float64(memStats.HeapInuse)
+	mapMetrics["HeapObjects"] = float64(memStats.HeapObjects)
+	mapMetrics["HeapReleased"] = float64(memStats.HeapReleased)
+	mapMetrics["HeapSys"] = float64(memStats.HeapSys)
+	mapMetrics["LastGC"] = float64(memStats.LastGC)
+	mapMetrics["Lookups"] = float64(memStats.Lookups)
+	mapMetrics["MCacheInuse"] = float64(memStats.MCacheInuse)
+	mapMetrics["MCacheSys"] = float64(memStats.MCacheSys)
+	mapMetrics["MSpanInuse"] = float64(memStats.MSpanInuse)
+	mapMetrics["MSpanSys"] = float64(memStats.MSpanSys)
+	mapMetrics["Mallocs"] = float64(memStats.Mallocs)
+	mapMetrics["NextGC"] = float64(memStats.NextGC)
+	mapMetrics["NumForcedGC"] = float64(memStats.NumForcedGC)
+	mapMetrics["NumGC"] = float64(memStats.NumGC)
+	mapMetrics["OtherSys"] = float64(memStats.OtherSys)
+	mapMetrics["PauseTotalNs"] = float64(memStats.PauseTotalNs)
+	mapMetrics["StackInuse"] = float64(memStats.StackInuse)
+	mapMetrics["StackSys"] = float64(memStats.StackSys)
+	mapMetrics["Sys"] = float64(memStats.Sys)
+	mapMetrics["TotalAlloc"] = float64(memStats.TotalAlloc)
+	mapMetrics["RandomValue"] = rand.Float64()
+
+	return MakeMetrics(mapMetrics, 1), nil
+}
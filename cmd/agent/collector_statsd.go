@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// StatsDCollectorName - name of collector of metrics, received by StatsD protocol.
+const StatsDCollectorName = "statsd"
+
+// DefaultStatsDAddress - default address of StatsD UDP listener.
+const DefaultStatsDAddress = ":8125"
+
+// maxStatsDPacket - maximum size of StatsD UDP packet.
+const maxStatsDPacket = 65535
+
+func init() {
+	RegisterAggregatingCollector(StatsDCollectorName, false, func(config data.CollectorConfig) (Collector, error) {
+		collector := &StatsDCollector{UDPAddress: config.UDPAddress, TCPAddress: config.TCPAddress}
+		if collector.UDPAddress == "" {
+			collector.UDPAddress = DefaultStatsDAddress
+		}
+		return collector, nil
+	})
+}
+
+// statsdSeries - data type to describe aggregated values of one StatsD series.
+type statsdSeries struct {
+	name    string
+	labels  map[string]string
+	value   float64
+	values  []float64
+	set     map[string]struct{}
+	updated bool // Flag, that series received samples since the previous collection
+}
+
+// StatsDCollector - collector, that receives metrics by StatsD protocol and aggregates them between collections.
+// Counters are reported as counters, gauges keep their values between collections,
+// timers and histograms are reported as min, max, mean and quantile gauges and counter of observations,
+// sets are reported as gauges with number of unique values. Tags in form "#key:value" are reported as labels.
+// Counters and numbers of observations are scaled by sample rates, fractional remainders of them are carried
+// into the next collection, so that sampled metrics are not underreported.
+type StatsDCollector struct {
+	UDPAddress  string // Address of UDP listener
+	TCPAddress  string // Address of TCP listener, TCP listener is disabled if address is empty
+	mutex       sync.Mutex
+	counters    map[string]*statsdSeries
+	gauges      map[string]*statsdSeries
+	timers      map[string]*statsdSeries
+	sets        map[string]*statsdSeries
+	invalid     int64
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+}
+
+// Name - function, that returns name of collector.
+func (c *StatsDCollector) Name() string {
+	return StatsDCollectorName
+}
+
+// Listen - function for starting UDP and TCP listeners.
+func (c *StatsDCollector) Listen(ctx context.Context) error {
+	var err error
+	listenConfig := net.ListenConfig{}
+
+	c.udpConn, err = listenConfig.ListenPacket(ctx, "udp", c.UDPAddress)
+	if err != nil {
+		return fmt.Errorf("error while starting StatsD UDP listener: %w", err)
+	}
+	go c.serveUDP()
+
+	if c.TCPAddress != "" {
+		c.tcpListener, err = listenConfig.Listen(ctx, "tcp", c.TCPAddress)
+		if err != nil {
+			c.udpConn.Close()
+			return fmt.Errorf("error while starting StatsD TCP listener: %w", err)
+		}
+		go c.serveTCP()
+	}
+
+	go func() {
+		<-ctx.Done()
+		c.udpConn.Close()
+		if c.tcpListener != nil {
+			c.tcpListener.Close()
+		}
+	}()
+
+	return nil
+}
+
+// serveUDP - function for receiving packets until connection is closed.
+func (c *StatsDCollector) serveUDP() {
+	buffer := make([]byte, maxStatsDPacket)
+	for {
+		n, _, err := c.udpConn.ReadFrom(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		for _, line := range strings.Split(string(buffer[:n]), "\n") {
+			c.handleLine(line)
+		}
+	}
+}
+
+// serveTCP - function for accepting connections until listener is closed.
+func (c *StatsDCollector) serveTCP() {
+	for {
+		conn, err := c.tcpListener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go func() {
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				c.handleLine(scanner.Text())
+			}
+		}()
+	}
+}
+
+// handleLine - function for parsing line and adding it to aggregated values.
+func (c *StatsDCollector) handleLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	sample, err := parseStatsDLine(line)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err != nil {
+		c.invalid++
+		return
+	}
+	c.add(sample)
+}
+
+// statsdSample - data type to describe one parsed StatsD line.
+type statsdSample struct {
+	name   string
+	kind   string
+	value  float64
+	raw    string
+	delta  bool
+	rate   float64
+	labels map[string]string
+}
+
+// parseStatsDLine - function, that parses line in form "name:value|type|@rate|#key:value,...".
+func parseStatsDLine(line string) (statsdSample, error) {
+	name, rest, found := strings.Cut(line, ":")
+	if !found || name == "" {
+		return statsdSample{}, fmt.Errorf("invalid StatsD line %q", line)
+	}
+
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return statsdSample{}, fmt.Errorf("type of StatsD metric %s is not set", name)
+	}
+
+	sample := statsdSample{name: name, kind: fields[1], raw: fields[0], rate: 1}
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return statsdSample{}, fmt.Errorf("invalid sample rate of StatsD metric %s: %s", name, field)
+			}
+			sample.rate = rate
+		case strings.HasPrefix(field, "#"):
+			sample.labels = make(map[string]string)
+			for _, tag := range strings.Split(field[1:], ",") {
+				key, value, _ := strings.Cut(tag, ":")
+				if key != "" {
+					sample.labels[key] = value
+				}
+			}
+		}
+	}
+
+	switch sample.kind {
+	case "c", "ms", "h":
+		value, err := parseStatsDValue(name, sample.raw)
+		if err != nil {
+			return statsdSample{}, err
+		}
+		sample.value = value
+	case "g":
+		value, err := parseStatsDValue(name, sample.raw)
+		if err != nil {
+			return statsdSample{}, err
+		}
+		sample.value = value
+		sample.delta = strings.HasPrefix(sample.raw, "+") || strings.HasPrefix(sample.raw, "-")
+	case "s":
+	default:
+		return statsdSample{}, fmt.Errorf("invalid type of StatsD metric %s: %s", name, sample.kind)
+	}
+
+	return sample, nil
+}
+
+// parseStatsDValue - function, that parses value of StatsD metric. NaN and infinity are rejected, because they can not be sent to server.
+func parseStatsDValue(name string, raw string) (float64, error) {
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value of StatsD metric %s: %w", name, err)
+	}
+	if !isFinite(value) {
+		return 0, fmt.Errorf("value of StatsD metric %s is not finite: %s", name, raw)
+	}
+
+	return value, nil
+}
+
+// roundCounter - function, that rounds aggregated value of counter. False is returned, if value does not fit int64.
+func roundCounter(value float64) (int64, bool) {
+	rounded := math.Round(value)
+	if !isFinite(rounded) || rounded >= math.MaxInt64 || rounded < math.MinInt64 {
+		return 0, false
+	}
+
+	return int64(rounded), true
+}
+
+// aggregateSeries - function, that returns series of sample from aggregation map. Mutex must be locked by caller.
+func aggregateSeries(aggregation *map[string]*statsdSeries, sample statsdSample) *statsdSeries {
+	if *aggregation == nil {
+		*aggregation = make(map[string]*statsdSeries)
+	}
+
+	key := data.SeriesKey(sample.name, sample.labels)
+	current, ok := (*aggregation)[key]
+	if !ok {
+		current = &statsdSeries{name: sample.name, labels: sample.labels}
+		(*aggregation)[key] = current
+	}
+
+	return current
+}
+
+// add - function for adding sample to aggregated values. Mutex must be locked by caller.
+// Sample, which makes aggregated value too big for sending, is counted as invalid line.
+func (c *StatsDCollector) add(sample statsdSample) {
+	switch sample.kind {
+	case "c":
+		current := aggregateSeries(&c.counters, sample)
+		value := current.value + sample.value/sample.rate
+		if _, ok := roundCounter(value); !ok {
+			c.invalid++
+			return
+		}
+		current.value = value
+		current.updated = true
+	case "g":
+		current := aggregateSeries(&c.gauges, sample)
+		value := sample.value
+		if sample.delta {
+			value += current.value
+		}
+		if !isFinite(value) {
+			c.invalid++
+			return
+		}
+		current.value = value
+	case "ms", "h":
+		// observation with sample rate stands for 1/rate observations as for counters
+		current := aggregateSeries(&c.timers, sample)
+		count := current.value + 1/sample.rate
+		if _, ok := roundCounter(count); !ok {
+			c.invalid++
+			return
+		}
+		current.value = count
+		current.values = append(current.values, sample.value)
+	case "s":
+		current := aggregateSeries(&c.sets, sample)
+		if current.set == nil {
+			current.set = make(map[string]struct{})
+		}
+		current.set[sample.raw] = struct{}{}
+	}
+}
+
+// Collect - function, that returns values, aggregated since the previous collection.
+func (c *StatsDCollector) Collect(ctx context.Context) ([]data.Metrics, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	metrics := make([]data.Metrics, 0, len(c.counters)+len(c.gauges)+len(c.timers)+len(c.sets)+1)
+	for key, current := range c.counters {
+		if !current.updated {
+			continue
+		}
+		delta, ok := roundCounter(current.value)
+		if !ok {
+			c.invalid++
+			delete(c.counters, key)
+			continue
+		}
+		metrics = append(metrics, counterMetric(current.name, delta, current.labels))
+		current.value -= float64(delta)
+		current.updated = false
+		if current.value == 0 {
+			delete(c.counters, key)
+		}
+	}
+	for _, current := range c.gauges {
+		metrics = append(metrics, gaugeMetric(current.name, current.value, current.labels))
+	}
+	for key, current := range c.timers {
+		if len(current.values) == 0 {
+			continue
+		}
+		count, _ := roundCounter(current.value)
+		metrics = append(metrics, timerMetrics(current, count)...)
+		current.value -= float64(count)
+		current.values = nil
+		if current.value == 0 {
+			delete(c.timers, key)
+		}
+	}
+	for _, current := range c.sets {
+		metrics = append(metrics, gaugeMetric(current.name, float64(len(current.set)), current.labels))
+	}
+	metrics = append(metrics, counterMetric("StatsDInvalidLines", c.invalid, nil))
+
+	c.sets = nil
+	c.invalid = 0
+
+	return metrics, nil
+}
+
+// timerMetrics - function, that converts values of timer or histogram to min, max, mean and quantile gauges
+// and counter of observations with value count.
+func timerMetrics(current *statsdSeries, count int64) []data.Metrics {
+	values := current.values
+	sort.Float64s(values)
+
+	// mean is summed from parts, so that sum of big values does not overflow
+	var mean float64
+	for _, value := range values {
+		mean += value / float64(len(values))
+	}
+
+	metrics := []data.Metrics{
+		counterMetric(current.name+"_count", count, current.labels),
+		gaugeMetric(current.name+"_min", values[0], current.labels),
+		gaugeMetric(current.name+"_max", values[len(values)-1], current.labels),
+		gaugeMetric(current.name+"_mean", mean, current.labels),
+	}
+	for _, q := range reportedQuantiles {
+		labels := data.CopyLabels(current.labels)
+		if labels == nil {
+			labels = make(map[string]string, 1)
+		}
+		labels["quantile"] = strconv.FormatFloat(q, 'f', -1, 64)
+		index := int(math.Ceil(q*float64(len(values)))) - 1
+		metrics = append(metrics, gaugeMetric(current.name, values[index], labels))
+	}
+
+	return metrics
+}
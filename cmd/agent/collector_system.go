@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/shirou/gopsutil/v4/mem"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// SystemCollectorName - name of collector of system metrics.
+const SystemCollectorName = "system"
+
+func init() {
+	RegisterCollector(SystemCollectorName, true, func(config data.CollectorConfig) (Collector, error) {
+		return NewSystemCollector(), nil
+	})
+}
+
+// SystemCollector - collector, that gets memory and swap usage, load average and utilization of every cpu.
+type SystemCollector struct {
+	virtualMemory  func(ctx context.Context) (*mem.VirtualMemoryStat, error)
+	swapMemory     func(ctx context.Context) (*mem.SwapMemoryStat, error)
+	loadAverage    func(ctx context.Context) (*load.AvgStat, error)
+	cpuUtilization func(ctx context.Context, interval time.Duration, percpu bool) ([]float64, error)
+}
+
+// NewSystemCollector - function, that creates collector of system metrics.
+func NewSystemCollector() *SystemCollector {
+	return &SystemCollector{
+		virtualMemory:  mem.VirtualMemoryWithContext,
+		swapMemory:     mem.SwapMemoryWithContext,
+		loadAverage:    load.AvgWithContext,
+		cpuUtilization: cpu.PercentWithContext,
+	}
+}
+
+// Name - function, that returns name of collector.
+func (c *SystemCollector) Name() string {
+	return SystemCollectorName
+}
+
+// Collect - function, that collects memory and swap usage, load average and utilization of every cpu.
+// Metrics, that were collected successfully, are returned together with errors.
+func (c *SystemCollector) Collect(ctx context.Context) ([]data.Metrics, error) {
+	mapMetrics := make(map[string]float64)
+	var errs []error
+
+	memStats, err := c.virtualMemory(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error while getting memory statistics: %w", err))
+	} else {
+		mapMetrics["TotalMemory"] = float64(memStats.Total)
+		mapMetrics["FreeMemory"] = float64(memStats.Free)
+		mapMetrics["AvailableMemory"] = float64(memStats.Available)
+		mapMetrics["UsedMemory"] = float64(memStats.Used)
+		mapMetrics["CachedMemory"] = float64(memStats.Cached)
+		mapMetrics["BuffersMemory"] = float64(memStats.Buffers)
+		mapMetrics["UsedMemoryPercent"] = memStats.UsedPercent
+	}
+
+	swapStats, err := c.swapMemory(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error while getting swap statistics: %w", err))
+	} else {
+		mapMetrics["SwapTotal"] = float64(swapStats.Total)
+		mapMetrics["SwapUsed"] = float64(swapStats.Used)
+		mapMetrics["SwapFree"] = float64(swapStats.Free)
+	}
+
+	loadStats, err := c.loadAverage(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error while getting load average: %w", err))
+	} else {
+		mapMetrics["Load1"] = loadStats.Load1
+		mapMetrics["Load5"] = loadStats.Load5
+		mapMetrics["Load15"] = loadStats.Load15
+	}
+
+	CPUutilization1, err := c.cpuUtilization(ctx, 0, true)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error while getting cpu utilization: %w", err))
+	}
+	for key, value := range CPUutilization1 {
+		cpuNum := strconv.Itoa(key)
+		metricName := "CPUutilization" + cpuNum
+		mapMetrics[metricName] = value
+	}
+
+	return GaugeMetrics(mapMetrics), errors.Join(errs...)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// AgentStatus - data type to describe state of agent, that is displayed by debug endpoint.
+// Methods of status can be called on nil status, when debug endpoint is disabled.
+type AgentStatus struct {
+	ServerAddress  string        // Address of server
+	Transport      string        // Transport for sending metrics
+	PollInterval   time.Duration // Default time duration for collecting metrics
+	ReportInterval time.Duration // Time duration for sending metrics
+	Spool          *Spool        // Spool of agent, nil if spool is disabled
+	Destinations   *Destinations // Servers, that receive metrics via HTTP
+	InFlight       func() int    // Function, that returns number of requests, which are being sent
+	mutex          sync.Mutex
+	batch          []data.Metrics
+	lastSend       *time.Time
+	lastError      string
+	lastErrorAt    *time.Time
+	retries        int64
+}
+
+// statusResponse - data type to describe body of status response.
+type statusResponse struct {
+	ServerAddress  string             `json:"server_address"`
+	Transport      string             `json:"transport"`
+	PollInterval   string             `json:"poll_interval"`
+	ReportInterval string             `json:"report_interval"`
+	LastSend       *time.Time         `json:"last_send,omitempty"`
+	LastError      string             `json:"last_error,omitempty"`
+	LastErrorAt    *time.Time         `json:"last_error_at,omitempty"`
+	Retries        int64              `json:"retries"`
+	InFlight       int                `json:"in_flight"`
+	QueueDepth     int                `json:"queue_depth"`
+	QueueBytes     int64              `json:"queue_bytes"`
+	BatchSize      int                `json:"batch_size"`
+	Destinations   []DestinationState `json:"destinations,omitempty"`
+}
+
+// SetBatch - function for saving the latest batch of metrics, prepared for sending.
+func (s *AgentStatus) SetBatch(metrics []data.Metrics) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.batch = metrics
+}
+
+// SendResult - function for saving result of sending batch to server.
+func (s *AgentStatus) SendResult(err error, now time.Time) {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err != nil {
+		s.lastError = err.Error()
+		s.lastErrorAt = &now
+		return
+	}
+	s.lastSend = &now
+}
+
+// Retry - function for counting retried request to server.
+func (s *AgentStatus) Retry() {
+	if s == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.retries++
+}
+
+// Handler - function, that returns handler of debug endpoint:
+// /metrics - the latest batch in Prometheus text format, /metrics.json - the latest batch in JSON,
+// /status - status of agent.
+func (s *AgentStatus) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", s.prometheusBatch)
+	mux.HandleFunc("GET /metrics.json", s.jsonBatch)
+	mux.HandleFunc("GET /status", s.status)
+
+	return mux
+}
+
+// latestBatch - function, that returns copy of the latest batch.
+func (s *AgentStatus) latestBatch() []data.Metrics {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]data.Metrics{}, s.batch...)
+}
+
+// prometheusBatch - handler, that displays the latest batch in Prometheus text format.
+func (s *AgentStatus) prometheusBatch(rw http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	err := data.WritePrometheus(&buf, s.latestBatch())
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", data.PrometheusContentType)
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(buf.Bytes())
+}
+
+// jsonBatch - handler, that displays the latest batch in JSON, as it is sent to server.
+func (s *AgentStatus) jsonBatch(rw http.ResponseWriter, r *http.Request) {
+	writeJSON(rw, s.latestBatch())
+}
+
+// status - handler, that displays status of agent.
+func (s *AgentStatus) status(rw http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	response := statusResponse{
+		ServerAddress:  s.ServerAddress,
+		Transport:      s.Transport,
+		PollInterval:   s.PollInterval.String(),
+		ReportInterval: s.ReportInterval.String(),
+		LastSend:       s.lastSend,
+		LastError:      s.lastError,
+		LastErrorAt:    s.lastErrorAt,
+		Retries:        s.retries,
+		BatchSize:      len(s.batch),
+	}
+	s.mutex.Unlock()
+
+	if s.InFlight != nil {
+		response.InFlight = s.InFlight()
+	}
+	if s.Destinations != nil && s.Transport == TransportHTTP {
+		response.Destinations = s.Destinations.States()
+	}
+	if s.Spool != nil {
+		response.QueueDepth, response.QueueBytes = s.Spool.Size()
+	}
+
+	writeJSON(rw, response)
+}
+
+// writeJSON - function for writing value to response in JSON.
+func writeJSON(rw http.ResponseWriter, value any) {
+	body, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(body)
+}
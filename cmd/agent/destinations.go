@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
+)
+
+// Strategies of sending metrics to several servers.
+const (
+	StrategyFailover = "failover" // Batch is sent to the first healthy server
+	StrategyFanout   = "fanout"   // Batch is sent to all healthy servers
+)
+
+// DefaultMaxPending - default maximum number of batches, that are kept for one server with fanout strategy.
+const DefaultMaxPending = 100
+
+// Destination - data type to describe server, that receives metrics, and its health.
+type Destination struct {
+	Address   string // Address of server
+	URL       string // URL for sending metrics
+	mutex     sync.Mutex
+	sendMutex sync.Mutex // Mutex for sending queue of server by one sender at a time
+	unhealthy bool
+	failures  int64
+	lastError string
+	pending   []func(url string) error
+	dropped   int64
+}
+
+// DestinationState - data type to describe state of destination for status of agent.
+type DestinationState struct {
+	Address   string `json:"address"`
+	Healthy   bool   `json:"healthy"`
+	Failures  int64  `json:"failures"`
+	LastError string `json:"last_error,omitempty"`
+	Pending   int    `json:"pending"`
+	Dropped   int64  `json:"dropped"`
+}
+
+// Destinations - data type to describe servers, that receive metrics, and strategy of sending.
+type Destinations struct {
+	Strategy   string
+	List       []*Destination
+	MaxPending int                // Maximum number of batches, that are kept for one server with fanout strategy
+	Logger     *zap.SugaredLogger // Logger for failures of separate servers, nil - failures are not logged
+	client     *resty.Client
+}
+
+// ParseAddresses - function, that splits comma-separated list of server addresses.
+func ParseAddresses(addresses string) []string {
+	result := make([]string, 0)
+	for _, address := range strings.Split(addresses, ",") {
+		address = strings.TrimSpace(address)
+		if address != "" {
+			result = append(result, address)
+		}
+	}
+
+	return result
+}
+
+// NewDestinations - function, that creates destinations from comma-separated list of server addresses.
+func NewDestinations(addresses string, strategy string, client *resty.Client) (*Destinations, error) {
+	if strategy != StrategyFailover && strategy != StrategyFanout {
+		return nil, fmt.Errorf("unknown strategy of sending %s", strategy)
+	}
+
+	destinations := &Destinations{Strategy: strategy, MaxPending: DefaultMaxPending, client: client}
+	for _, address := range ParseAddresses(addresses) {
+		destinations.List = append(destinations.List, &Destination{Address: address, URL: MakeString(address)})
+	}
+	if len(destinations.List) == 0 {
+		return nil, fmt.Errorf("server address is empty")
+	}
+
+	return destinations, nil
+}
+
+// Send - function for sending batch to servers according to strategy.
+// With failover strategy batch is sent to servers in order, until one of them accepts it.
+// With fanout strategy batch is sent to all servers concurrently. Every server has its own queue of batches,
+// which it did not receive: queue is sent before the next batch, so that server gets batches in order.
+// Sending fails only if no server accepted batch, then batch is not queued, because it is sent again by caller.
+// Servers, which failed previously, receive batch only after successful /ping probe.
+func (d *Destinations) Send(send func(url string) error) error {
+	if d.Strategy == StrategyFanout {
+		errs := make([]error, len(d.List))
+		var wg sync.WaitGroup
+		for i, destination := range d.List {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = d.sendPending(destination, send)
+			}()
+		}
+		wg.Wait()
+
+		delivered := false
+		for _, err := range errs {
+			if err == nil {
+				delivered = true
+			}
+		}
+		if !delivered {
+			return errors.Join(errs...)
+		}
+
+		for i, err := range errs {
+			if err != nil {
+				d.enqueue(d.List[i], send)
+				if d.Logger != nil {
+					d.Logger.Errorln("Batch is queued for server: ", err)
+				}
+			}
+		}
+		return nil
+	}
+
+	var errs []error
+	for _, destination := range d.List {
+		err := d.sendTo(destination, send)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// sendPending - function for sending queued batches of server and then the new batch.
+// Sending stops on the first error, batches, which were not sent, stay in queue.
+// Senders of one server are serialized, so that queued batch is sent and removed from queue only once.
+func (d *Destinations) sendPending(destination *Destination, send func(url string) error) error {
+	destination.sendMutex.Lock()
+	defer destination.sendMutex.Unlock()
+
+	for {
+		destination.mutex.Lock()
+		if len(destination.pending) == 0 {
+			destination.mutex.Unlock()
+			break
+		}
+		pending := destination.pending[0]
+		destination.mutex.Unlock()
+
+		err := d.sendTo(destination, pending)
+		if err != nil {
+			return err
+		}
+
+		destination.mutex.Lock()
+		destination.pending = destination.pending[1:]
+		destination.mutex.Unlock()
+	}
+
+	return d.sendTo(destination, send)
+}
+
+// enqueue - function for saving batch to queue of server. The oldest batches are dropped, when queue is full.
+func (d *Destinations) enqueue(destination *Destination, send func(url string) error) {
+	destination.mutex.Lock()
+	defer destination.mutex.Unlock()
+
+	destination.pending = append(destination.pending, send)
+	for d.MaxPending > 0 && len(destination.pending) > d.MaxPending {
+		destination.pending = destination.pending[1:]
+		destination.dropped++
+	}
+}
+
+// sendTo - function for sending batch to one server and updating its health.
+func (d *Destinations) sendTo(destination *Destination, send func(url string) error) error {
+	destination.mutex.Lock()
+	unhealthy := destination.unhealthy
+	destination.mutex.Unlock()
+
+	if unhealthy {
+		err := d.probe(destination)
+		if err != nil {
+			destination.mutex.Lock()
+			destination.failures++
+			destination.mutex.Unlock()
+			return fmt.Errorf("server %s is unhealthy: %w", destination.Address, err)
+		}
+	}
+
+	err := send(destination.URL)
+
+	destination.mutex.Lock()
+	defer destination.mutex.Unlock()
+	if err != nil {
+		destination.unhealthy = true
+		destination.failures++
+		destination.lastError = err.Error()
+		return fmt.Errorf("error while sending metrics to %s: %w", destination.Address, err)
+	}
+	destination.unhealthy = false
+
+	return nil
+}
+
+// probe - function for checking health of server with /ping request.
+func (d *Destinations) probe(destination *Destination) error {
+	response, err := d.client.R().Get("http://" + destination.Address + "/ping")
+	if err == nil && response.IsError() {
+		err = fmt.Errorf("ping responded with status %s", response.Status())
+	}
+	if err != nil {
+		destination.mutex.Lock()
+		destination.lastError = err.Error()
+		destination.mutex.Unlock()
+	}
+
+	return err
+}
+
+// States - function, that returns states of all destinations.
+func (d *Destinations) States() []DestinationState {
+	states := make([]DestinationState, 0, len(d.List))
+	for _, destination := range d.List {
+		destination.mutex.Lock()
+		states = append(states, DestinationState{
+			Address:   destination.Address,
+			Healthy:   !destination.unhealthy,
+			Failures:  destination.failures,
+			LastError: destination.lastError,
+			Pending:   len(destination.pending),
+			Dropped:   destination.dropped,
+		})
+		destination.mutex.Unlock()
+	}
+
+	return states
+}
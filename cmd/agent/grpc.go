@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+	pb "github.com/Tanya1515/metrics-collector.git/cmd/proto"
+	retry "github.com/Tanya1515/metrics-collector.git/cmd/retry"
+)
+
+// Transports for sending metrics to server.
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+// NewGRPCClient - function, that makes connection to gRPC server and client of metrics service.
+func NewGRPCClient(grpcAddress string) (*grpc.ClientConn, pb.MetricsServiceClient, error) {
+	conn, err := grpc.NewClient(grpcAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return conn, pb.NewMetricsServiceClient(conn), nil
+}
+
+// signContext - function, that adds HMAC-SHA256 of request with timestamp and nonce to outgoing gRPC metadata.
+// Every attempt of sending must be signed again, because server rejects repeated nonces.
+func signContext(ctx context.Context, secretKey string, request *pb.UpdateMetricsRequest) (context.Context, error) {
+	if secretKey == "" {
+		return ctx, nil
+	}
+
+	nonce, err := data.NewNonce()
+	if err != nil {
+		return ctx, err
+	}
+	timestamp := data.NewTimestamp(time.Now())
+
+	sign, err := pb.Sign(secretKey, timestamp, nonce, request)
+	if err != nil {
+		return ctx, err
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, pb.HashMetadataKey, sign, pb.TimestampMetadataKey, timestamp, pb.NonceMetadataKey, nonce), nil
+}
+
+// SendMetricsGRPC - function for sending pool of metrics to server via gRPC with retries according to policy.
+func SendMetricsGRPC(ctx context.Context, client pb.MetricsServiceClient, metrics []data.Metrics, secretKey string, policy retry.Policy) error {
+	request := pb.FromMetrics(metrics)
+
+	return retry.Do(ctx, policy, func() error {
+		ctx, err := signContext(ctx, secretKey, request)
+		if err != nil {
+			return err
+		}
+		_, err = client.UpdateMetrics(ctx, request)
+		return err
+	})
+}
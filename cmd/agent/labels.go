@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// Names of identity labels, that are added by agent to every metric.
+const (
+	HostLabel     = "host"
+	InstanceLabel = "instance"
+	EnvLabel      = "env"
+)
+
+// HostNone - value of host, that disables host label.
+const HostNone = "-"
+
+// ParseLabels - function, that converts string in form key1=value1,key2=value2 to labels.
+func ParseLabels(labelsString string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(labelsString, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, value, found := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid label: %s", pair)
+		}
+		labels[name] = strings.TrimSpace(value)
+	}
+
+	return labels, nil
+}
+
+// IdentityLabels - function, that makes labels, that identify agent: host, instance, environment and additional labels.
+// Labels with empty values are not included. Host, instance and environment take precedence over additional labels.
+func IdentityLabels(host, instance, env string, extraLabels map[string]string) map[string]string {
+	labels := make(map[string]string, len(extraLabels)+3)
+	for name, value := range extraLabels {
+		if value != "" {
+			labels[name] = value
+		}
+	}
+
+	if host != "" {
+		labels[HostLabel] = host
+	}
+	if instance != "" {
+		labels[InstanceLabel] = instance
+	}
+	if env != "" {
+		labels[EnvLabel] = env
+	}
+
+	return labels
+}
+
+// AddLabels - function, that adds labels to every metric from list.
+// Labels, that are already set in metric, are not overwritten.
+func AddLabels(metrics []data.Metrics, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+
+	for i := range metrics {
+		metricLabels := make(map[string]string, len(labels)+len(metrics[i].Labels))
+		for name, value := range labels {
+			metricLabels[name] = value
+		}
+		for name, value := range metrics[i].Labels {
+			metricLabels[name] = value
+		}
+		metrics[i].Labels = metricLabels
+	}
+}
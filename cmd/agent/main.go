@@ -8,16 +8,14 @@ package main
 import (
 	"context"
 	"crypto/hmac"
-	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"math/rand"
+	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
-	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,12 +23,12 @@ import (
 	"time"
 
 	"github.com/go-resty/resty/v2"
-	"github.com/shirou/gopsutil/v4/cpu"
-	"github.com/shirou/gopsutil/v4/mem"
 	"go.uber.org/zap"
 
 	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
 	retryerr "github.com/Tanya1515/metrics-collector.git/cmd/errors"
+	pb "github.com/Tanya1515/metrics-collector.git/cmd/proto"
+	retry "github.com/Tanya1515/metrics-collector.git/cmd/retry"
 )
 
 var (
@@ -45,6 +43,17 @@ var (
 	cryptoKeyPathFlag       *string
 	configFilePathFlag      *string
 	limitServerRequestsFlag *int
+	hostFlag                *string
+	instanceFlag            *string
+	envFlag                 *string
+	labelsFlag              *string
+	transportFlag           *string
+	spoolDirFlag            *string
+	spoolMaxBytesFlag       *int64
+	debugAddressFlag        *string
+	strategyFlag            *string
+	grpcAddressFlag         *string
+	retryFlags              *retry.Flags
 	buildVersion            string = "N/A"
 	buildDate               string = "N/A"
 	buildCommit             string = "N/A"
@@ -53,139 +62,140 @@ var (
 func init() {
 	ReportIntervalFlag = flag.Int("r", 10, "time duration for sending metrics")
 	PollIntervalFlag = flag.Int("p", 2, "time duration for getting metrics")
-	serverAddressFlag = flag.String("a", "localhost:8080", "server address")
+	serverAddressFlag = flag.String("a", "localhost:8080", "server address, several addresses are separated by comma")
+	strategyFlag = flag.String("strategy", StrategyFailover, "strategy of sending metrics to several servers: failover or fanout")
 	secretKeyFlag = flag.String("k", "", "secret key for creating hash")
 	limitServerRequestsFlag = flag.Int("l", 1, "limit of requests to server")
-	cryptoKeyPathFlag = flag.String("crypto-key", "", "path to key for asymmetrical encryption")
+	cryptoKeyPathFlag = flag.String("crypto-key", "", "path to key for asymmetrical encryption, supported only by http transport")
 	configFilePathFlag = flag.String("config", "", "path to config file for the application")
+	hostFlag = flag.String("host", "", "host name for labels of metrics, hostname of the machine by default, \"-\" - do not send host label")
+	instanceFlag = flag.String("instance", "", "identifier of agent instance for labels of metrics")
+	envFlag = flag.String("env", "", "environment name for labels of metrics")
+	spoolDirFlag = flag.String("spool-dir", "", "directory for saving metrics, that were not sent to server, spool is disabled if directory is empty")
+	spoolMaxBytesFlag = flag.Int64("spool-max-bytes", 64<<20, "maximum size of spool in bytes")
+	debugAddressFlag = flag.String("debug-address", "", "address of debug endpoint with the latest batch and status of agent, endpoint is disabled if address is empty")
+	transportFlag = flag.String("transport", TransportHTTP, "transport for sending metrics: http or grpc")
+	grpcAddressFlag = flag.String("grpc-address", "localhost:3200", "address of gRPC server")
+	labelsFlag = flag.String("labels", "", "additional labels of metrics in form key1=value1,key2=value2")
+	retryFlags = retry.NewFlags()
 }
 
-// MakeMetrics - make list of data.Metrics from map.
-func MakeMetrics(mapMetrics map[string]float64, pollCount int64) []data.Metrics {
-	metrics := make([]data.Metrics, len(mapMetrics)+1)
-	i := 0
+// GaugeMetrics - make list of gauge data.Metrics from map.
+func GaugeMetrics(mapMetrics map[string]float64) []data.Metrics {
+	metrics := make([]data.Metrics, 0, len(mapMetrics))
 
 	for metricName, metricValue := range mapMetrics {
 		metricData := data.Metrics{}
 		metricData.ID = metricName
 		metricData.MType = "gauge"
 		metricData.Value = &metricValue
-		metrics[i] = metricData
-		i += 1
+		metrics = append(metrics, metricData)
 	}
+
+	return metrics
+}
+
+// MakeMetrics - make list of data.Metrics from map.
+func MakeMetrics(mapMetrics map[string]float64, pollCount int64) []data.Metrics {
+	metrics := GaugeMetrics(mapMetrics)
+
 	metricData := data.Metrics{}
 	metricData.ID = "PollCount"
 	metricData.MType = "counter"
 	metricData.Delta = &pollCount
-	metrics[i] = metricData
 
-	return metrics
+	return append(metrics, metricData)
 }
 
-// GetMetrics - function, that collects all metrics from runtime library
-func GetMetrics(ctx context.Context, chanSend chan int64, chanMetrics chan []data.Metrics, timer time.Duration) {
-	var memStats runtime.MemStats
-	mapMetrics := make(map[string]float64)
-	var pollCount int64
-	for {
-		runtime.ReadMemStats(&memStats)
-		mapMetrics["Alloc"] = float64(memStats.Alloc)
-		mapMetrics["BuckHashSys"] = float64(memStats.BuckHashSys)
-		mapMetrics["Frees"] = float64(memStats.Frees)
-		mapMetrics["GCCPUFraction"] = float64(memStats.GCCPUFraction)
-		mapMetrics["GCSys"] = float64(memStats.GCSys)
-		mapMetrics["HeapAlloc"] = float64(memStats.HeapAlloc)
-		mapMetrics["HeapIdle"] = float64(memStats.HeapIdle)
-		mapMetrics["HeapInuse"] = float64(memStats.HeapInuse)
-		mapMetrics["HeapObjects"] = float64(memStats.HeapObjects)
-		mapMetrics["HeapReleased"] = float64(memStats.HeapReleased)
-		mapMetrics["HeapSys"] = float64(memStats.HeapSys)
-		mapMetrics["LastGC"] = float64(memStats.LastGC)
-		mapMetrics["Lookups"] = float64(memStats.Lookups)
-		mapMetrics["MCacheInuse"] = float64(memStats.MCacheInuse)
-		mapMetrics["MCacheSys"] = float64(memStats.MCacheSys)
-		mapMetrics["MSpanInuse"] = float64(memStats.MSpanInuse)
-		mapMetrics["MSpanSys"] = float64(memStats.MSpanSys)
-		mapMetrics["Mallocs"] = float64(memStats.Mallocs)
-		mapMetrics["NextGC"] = float64(memStats.NextGC)
-		mapMetrics["NumForcedGC"] = float64(memStats.NumForcedGC)
-		mapMetrics["NumGC"] = float64(memStats.NumGC)
-		mapMetrics["OtherSys"] = float64(memStats.OtherSys)
-		mapMetrics["PauseTotalNs"] = float64(memStats.PauseTotalNs)
-		mapMetrics["StackInuse"] = float64(memStats.StackInuse)
-		mapMetrics["StackSys"] = float64(memStats.StackSys)
-		mapMetrics["Sys"] = float64(memStats.Sys)
-		mapMetrics["TotalAlloc"] = float64(memStats.TotalAlloc)
-		mapMetrics["RandomValue"] = rand.Float64()
+// MakeString - function, that makes request-string for sending metrics to server.
+func MakeString(serverAddress string) string {
+	builder := strings.Builder{}
+	builder.WriteString("http://")
+	builder.WriteString(serverAddress)
+	builder.WriteString("/updates/")
 
-		select {
-		case signal, ok := <-chanSend:
-			if !ok {
-				return
-			}
-			if signal == -1 {
-				metrics := MakeMetrics(mapMetrics, pollCount)
-				chanMetrics <- metrics
-			} else {
-				pollCount = signal
-			}
-		case <-ctx.Done():
-			return
-		default:
-			time.Sleep(timer * time.Second)
-		}
-		pollCount += 1
-	}
+	return builder.String()
 }
 
-// GetMetricsUtil - function, that collects total/free memory and utilizatin of every cpu.
-func GetMetricsUtil(ctx context.Context, chanSend chan int64, chanMetrics chan []data.Metrics, timer time.Duration) {
-	var memStats mem.VirtualMemoryStat
-	mapMetrics := make(map[string]float64)
-	var pollCount int64
-	for {
-		freeMemory := memStats.Free
-		totalMemory := memStats.Total
+// CheckResponse - function, that checks status of server response and its HashSHA256 header, if key is set.
+// Sign of response covers timestamp and nonce of request, so response to another request is rejected.
+// Unsuccessful status is returned as retryerr.StatusError, so that it can be classified for retries.
+func CheckResponse(response *resty.Response, secretKey string, timestamp string, nonce string) error {
+	if !response.IsSuccess() {
+		return retryerr.NewStatusError(response.StatusCode(), response.Header(), time.Now())
+	}
+	if secretKey == "" {
+		return nil
+	}
 
-		CPUutilization1, _ := cpu.Percent(0, true)
+	sign := response.Header().Get("HashSHA256")
+	if sign == "" {
+		return fmt.Errorf("server response is not signed")
+	}
+	signDecode, err := hex.DecodeString(sign)
+	if err != nil {
+		return fmt.Errorf("error during HashSHA256 decoding: %w", err)
+	}
 
-		mapMetrics["TotalMemory"] = float64(totalMemory)
-		mapMetrics["FreeMemory"] = float64(freeMemory)
-		for key, value := range CPUutilization1 {
-			cpuNum := strconv.Itoa(key)
-			metricName := "CPUutilization" + cpuNum
-			mapMetrics[metricName] = value
-		}
+	signCheck, _ := hex.DecodeString(data.SignRequest(secretKey, timestamp, nonce, response.Body()))
+	if !(hmac.Equal(signDecode, signCheck)) {
+		return fmt.Errorf("HashSHA256 of server response is incorrect")
+	}
 
-		select {
-		case signal, ok := <-chanSend:
-			if !ok {
-				return
-			}
-			if signal == -1 {
-				metrics := MakeMetrics(mapMetrics, pollCount)
-				chanMetrics <- metrics
-			} else {
-				pollCount = signal
-			}
-		case <-ctx.Done():
-			return
-		default:
-			time.Sleep(timer * time.Second)
+	return nil
+}
+
+// SendMetricsHTTP - function for sending pool of metrics to servers via HTTP with retries according to policy.
+// Server checks sign of request body after decrypting and unpacking it,
+// so the same serialized metrics are signed and compressed.
+func SendMetricsHTTP(ctx context.Context, client *resty.Client, destinations *Destinations, metrics []data.Metrics, secretKey string, cryptoKey []byte, policy retry.Policy) error {
+	metricsBytes, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+	compressedMetrics, err := data.CompressBytes(metricsBytes)
+	if err != nil {
+		return err
+	}
+	if cryptoKey != nil {
+		compressedMetrics, err = data.EncryptData(compressedMetrics, cryptoKey)
+		if err != nil {
+			return err
 		}
-		pollCount += 1
 	}
 
-}
+	// with fanout strategy function is called concurrently for every server, so it must not share variables of attempts
+	return destinations.Send(func(url string) error {
+		return retry.Do(ctx, policy, func() error {
+			request := client.R().
+				SetHeader("Content-Type", "application/json").
+				SetHeader("Content-Encoding", "gzip").
+				SetBody(compressedMetrics)
+			if cryptoKey != nil {
+				request.SetHeader("X-Encrypted", data.EncryptionHybrid)
+			}
+			var timestamp, nonce string
+			if secretKey != "" {
+				// every request has its own nonce, because server rejects repeated nonces
+				var err error
+				nonce, err = data.NewNonce()
+				if err != nil {
+					return err
+				}
+				timestamp = data.NewTimestamp(time.Now())
+				request.SetHeader(data.TimestampHeader, timestamp).
+					SetHeader(data.NonceHeader, nonce).
+					SetHeader("HashSHA256", data.SignRequest(secretKey, timestamp, nonce, metricsBytes))
+			}
 
-// MakeString - function, that makes request-string for sending metrics to server.
-func MakeString(serverAddress string) string {
-	builder := strings.Builder{}
-	builder.WriteString("http://")
-	builder.WriteString(serverAddress)
-	builder.WriteString("/updates/")
+			response, err := request.Post(url)
+			if err != nil {
+				return err
+			}
 
-	return builder.String()
+			return CheckResponse(response, secretKey, timestamp, nonce)
+		})
+	})
 }
 
 func main() {
@@ -194,14 +204,8 @@ func main() {
 	fmt.Println("Build commit: ", buildCommit)
 	var err error
 	var cryptoKey []byte
-	chansPollCount := []chan int64{
-		make(chan int64),
-		make(chan int64),
-	}
 	resultChannel := make(chan error)
-	defer close(chansPollCount[0])
-	defer close(chansPollCount[1])
-	chanMetrics := make(chan []data.Metrics, 10)
+	snapshot := &Snapshot{}
 
 	client := resty.New()
 
@@ -320,16 +324,202 @@ func main() {
 	if secretKeyHash == "" && configFilePath != "" {
 		secretKeyHash = configAgent.SecretKey
 	}
-	requestString := MakeString(serverAddress)
+	host, envExists := os.LookupEnv("AGENT_HOST")
+	if !(envExists) {
+		host = *hostFlag
+	}
+
+	if host == "" && configFilePath != "" {
+		host = configAgent.Host
+	}
+
+	// every agent has its own series on server, unless host label is disabled
+	if host == "" {
+		host, err = os.Hostname()
+		if err != nil {
+			Logger.Errorln("Error while getting hostname: ", err)
+		}
+	}
+	if host == HostNone {
+		host = ""
+	}
+
+	instance, envExists := os.LookupEnv("INSTANCE_ID")
+	if !(envExists) {
+		instance = *instanceFlag
+	}
+
+	if instance == "" && configFilePath != "" {
+		instance = configAgent.InstanceID
+	}
+
+	env, envExists := os.LookupEnv("AGENT_ENV")
+	if !(envExists) {
+		env = *envFlag
+	}
+
+	if env == "" && configFilePath != "" {
+		env = configAgent.Env
+	}
+
+	labelsString, envExists := os.LookupEnv("LABELS")
+	if !(envExists) {
+		labelsString = *labelsFlag
+	}
+
+	extraLabels, err := ParseLabels(labelsString)
+	if err != nil {
+		Logger.Errorln("Error while parsing labels: ", err)
+	}
+
+	if len(extraLabels) == 0 && configFilePath != "" {
+		extraLabels = configAgent.Labels
+	}
+
+	identityLabels := IdentityLabels(host, instance, env, extraLabels)
+
+	transport, envExists := os.LookupEnv("TRANSPORT")
+	if !(envExists) {
+		transport = *transportFlag
+	}
+
+	if transport == TransportHTTP && configFilePath != "" && configAgent.Transport != "" {
+		transport = configAgent.Transport
+	}
+
+	grpcAddress, envExists := os.LookupEnv("GRPC_ADDRESS")
+	if !(envExists) {
+		grpcAddress = *grpcAddressFlag
+	}
+
+	if grpcAddress == "localhost:3200" && configFilePath != "" && configAgent.GRPCAddress != "" {
+		grpcAddress = configAgent.GRPCAddress
+	}
+
+	spoolDir, envExists := os.LookupEnv("SPOOL_DIR")
+	if !(envExists) {
+		spoolDir = *spoolDirFlag
+	}
+
+	if spoolDir == "" && configFilePath != "" {
+		spoolDir = configAgent.SpoolDir
+	}
+
+	spoolMaxBytes := *spoolMaxBytesFlag
+	spoolMaxBytesEnv, envExists := os.LookupEnv("SPOOL_MAX_BYTES")
+	if envExists {
+		spoolMaxBytes, err = strconv.ParseInt(spoolMaxBytesEnv, 10, 64)
+		if err != nil {
+			Logger.Errorln("Error while transforming to int: ", err)
+		}
+	}
+
+	if spoolMaxBytes == 64<<20 && configFilePath != "" && configAgent.SpoolMaxBytes != 0 {
+		spoolMaxBytes = configAgent.SpoolMaxBytes
+	}
+
+	var spool *Spool
+	if spoolDir != "" {
+		spool = &Spool{Dir: spoolDir, MaxBytes: spoolMaxBytes}
+		err = spool.Init()
+		if err != nil {
+			Logger.Errorln("Error while initialization of spool: ", err)
+			spool = nil
+		}
+	}
+
+	strategy, envExists := os.LookupEnv("SEND_STRATEGY")
+	if !(envExists) {
+		strategy = *strategyFlag
+	}
+
+	if strategy == StrategyFailover && configFilePath != "" && configAgent.Strategy != "" {
+		strategy = configAgent.Strategy
+	}
+
+	debugAddress, envExists := os.LookupEnv("DEBUG_ADDRESS")
+	if !(envExists) {
+		debugAddress = *debugAddressFlag
+	}
+
+	if debugAddress == "" && configFilePath != "" {
+		debugAddress = configAgent.DebugAddress
+	}
+
+	retryPolicy, err := retryFlags.Policy(configAgent.Retry, configFilePath)
+	if err != nil {
+		Logger.Fatalw(err.Error(), "event", "parse retry policy")
+	}
+
+	var grpcClient pb.MetricsServiceClient
+	switch transport {
+	case TransportGRPC:
+		if len(ParseAddresses(serverAddress)) > 1 {
+			Logger.Fatalw("several server addresses are supported only by HTTP transport", "event", "choose transport")
+		}
+		// gRPC transport does not encrypt metrics, so they must not be sent in plaintext, when encryption is requested
+		if cryptoKeyPath != "" {
+			Logger.Fatalw("encryption with crypto key is supported only by HTTP transport", "event", "choose transport")
+		}
+		grpcConn, client, err := NewGRPCClient(grpcAddress)
+		if err != nil {
+			Logger.Fatalw(err.Error(), "event", "create gRPC client")
+		}
+		defer grpcConn.Close()
+		grpcClient = client
+	case TransportHTTP:
+	default:
+		Logger.Fatalw("unknown transport "+transport, "event", "choose transport")
+	}
+
+	destinations, err := NewDestinations(serverAddress, strategy, client)
+	if err != nil {
+		Logger.Fatalw(err.Error(), "event", "create destinations")
+	}
+	destinations.Logger = &Logger
+	sem := make(chan struct{}, limitRequests)
+
+	var status *AgentStatus
+	var debugServer *http.Server
+	if debugAddress != "" {
+		status = &AgentStatus{
+			ServerAddress:  serverAddress,
+			Transport:      transport,
+			PollInterval:   time.Duration(pollInt) * time.Second,
+			ReportInterval: time.Duration(reportInt) * time.Second,
+			Spool:          spool,
+			Destinations:   destinations,
+			InFlight:       func() int { return len(sem) },
+		}
+		if transport == TransportGRPC {
+			status.ServerAddress = grpcAddress
+		}
+		debugServer = &http.Server{Addr: debugAddress, Handler: status.Handler()}
+		go func() {
+			err := debugServer.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				Logger.Errorln("Error while running debug endpoint: ", err)
+			}
+		}()
+	}
+
+	// retries are counted in status of agent
+	retryPolicy = retryPolicy.WithOnRetry(func(attempt int, err error, delay time.Duration) {
+		status.Retry()
+	})
 
 	gracefulSutdown := make(chan os.Signal, 1)
 	shutdown := make(chan struct{})
 	signal.Notify(gracefulSutdown, syscall.SIGINT, syscall.SIGTERM)
 	ctx, cancel := context.WithCancel(context.Background())
 
-	go GetMetrics(ctx, chansPollCount[0], chanMetrics, time.Duration(pollInt))
-
-	go GetMetricsUtil(ctx, chansPollCount[1], chanMetrics, time.Duration(pollInt))
+	scheduledCollectors, err := NewCollectors(configAgent.Collectors, time.Duration(pollInt)*time.Second, time.Duration(reportInt)*time.Second)
+	if err != nil {
+		Logger.Fatalw(err.Error(), "event", "create collectors")
+	}
+	for _, collector := range scheduledCollectors {
+		go RunCollector(ctx, collector, snapshot, Logger)
+	}
 	var wg sync.WaitGroup
 	go func() {
 		<-gracefulSutdown
@@ -339,7 +529,29 @@ func main() {
 		close(resultChannel)
 	}()
 
-	sem := make(chan struct{}, limitRequests)
+	// sendMetrics - function for sending pool of metrics to server with chosen transport
+	sendMetrics := func(metrics []data.Metrics) error {
+		if grpcClient != nil {
+			return SendMetricsGRPC(ctx, grpcClient, metrics, secretKeyHash, retryPolicy)
+		}
+
+		return SendMetricsHTTP(ctx, client, destinations, metrics, secretKeyHash, cryptoKey, retryPolicy)
+	}
+
+	if spool != nil {
+		// pools, saved to spool by previous run of agent, are sent without waiting for the first report interval
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			err := spool.Replay(sendMetrics)
+			if err != nil {
+				Logger.Errorln("Error while sending metrics from spool: ", err)
+			}
+		}()
+	}
+
 	for {
 		select {
 		case result := <-resultChannel:
@@ -363,81 +575,49 @@ func main() {
 				}
 				Logger.Infoln("Wait for canceling goroutines, that gather metrics")
 				cancel()
+				if debugServer != nil {
+					debugServer.Close()
+				}
 				Logger.Infoln("Stop agent")
 				return
 			default:
-				for i := range chansPollCount {
-					chansPollCount[i] <- -1
-					chanPollCount := chansPollCount[i]
-					wg.Add(1)
-					go func() {
-						Logger.Infoln("Start sending metrics to server")
-						defer wg.Done()
-						metrics := <-chanMetrics
-						var sign []byte
-
-						compressedMetrics, err := data.Compress(&metrics)
-						if err != nil {
-							resultChannel <- err
-							return
-
-						}
-						if cryptoKey != nil {
-							compressedMetrics, err = data.EncryptData(compressedMetrics, cryptoKey)
-							if err != nil {
-								resultChannel <- err
-								return
-							}
-						}
-						if secretKeyHash != "" {
-							h := hmac.New(sha256.New, []byte(secretKeyHash))
-							h.Write(compressedMetrics)
-							sign = h.Sum(nil)
+				wg.Add(1)
+				go func() {
+					Logger.Infoln("Start sending metrics to server")
+					defer wg.Done()
+					collected := snapshot.Take()
+					metrics := append([]data.Metrics{}, collected...)
+					var spoolMetrics []data.Metrics
+					if spool != nil {
+						spoolMetrics = spool.SelfMetrics()
+						metrics = append(metrics, spoolMetrics...)
+					}
+					AddLabels(metrics, identityLabels)
+					status.SetBatch(metrics)
+
+					sem <- struct{}{}
+					defer func() { <-sem }()
+					var err error
+					if spool != nil {
+						// pool is sent after pools from spool, so that older values do not overwrite newer ones on server
+						var spooled bool
+						spooled, err = spool.Send(metrics, sendMetrics)
+						if spooled {
+							// pool is sent later from spool, so collected counters must not be sent twice
+							Logger.Infoln("Metrics were saved to spool")
+						} else if err != nil {
+							snapshot.Return(collected)
+							spool.ReturnDropped(spoolMetrics)
 						}
-
-						sem <- struct{}{}
-						defer func() { <-sem }()
-						for i := 0; i <= 3; i++ {
-							if secretKeyHash != "" && cryptoKey != nil {
-								_, err = client.R().
-									SetHeader("Content-Type", "application/json").
-									SetHeader("Content-Encoding", "gzip").
-									SetHeader("X-Encrypted", "rsa").
-									SetHeader("HashSHA256", hex.EncodeToString(sign)).
-									SetBody(compressedMetrics).
-									Post(requestString)
-							} else if cryptoKey != nil {
-								_, err = client.R().
-									SetHeader("Content-Type", "application/json").
-									SetHeader("Content-Encoding", "gzip").
-									SetHeader("X-Encrypted", "rsa").
-									SetBody(compressedMetrics).
-									Post(requestString)
-							} else {
-								_, err = client.R().
-									SetHeader("Content-Type", "application/json").
-									SetHeader("Content-Encoding", "gzip").
-									SetBody(compressedMetrics).
-									Post(requestString)
-							}
-							if err == nil {
-								chanPollCount <- 0
-								break
-							}
-							if !(retryerr.CheckErrorType(err)) || (i == 3) {
-								break
-							}
-
-							if i == 0 {
-								time.Sleep(1 * time.Second)
-							} else {
-								time.Sleep(time.Duration(i+i+1) * time.Second)
-							}
-
+					} else {
+						err = sendMetrics(metrics)
+						if err != nil {
+							snapshot.Return(collected)
 						}
-						resultChannel <- err
-					}()
-				}
+					}
+					status.SendResult(err, time.Now())
+					resultChannel <- err
+				}()
 			}
 		}
 	}
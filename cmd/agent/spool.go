@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// Suffixes of spool segment files.
+const (
+	segmentSuffix = ".seg" // Suffix of segment file
+	tmpSuffix     = ".tmp" // Suffix of segment file, that is being written
+)
+
+// Spool - data type to describe durable queue of metrics pools, that were not sent to server.
+// Every pool is saved into its own segment file, which starts with crc32 checksum of the pool.
+type Spool struct {
+	Dir         string // Directory for segment files
+	MaxBytes    int64  // Maximum size of all segment files, the oldest segments are removed when size is exceeded
+	mutex       sync.Mutex
+	replayMutex sync.Mutex
+	segments    []segment
+	size        int64
+	nextSeq     uint64
+	dropped     int64
+}
+
+// segment - data type to describe segment file of spool.
+type segment struct {
+	seq  uint64
+	size int64
+}
+
+// Init - function for creating spool directory and loading list of existing segments.
+// Temporary segment files are left by crash during writing, so they are removed.
+func (s *Spool) Init() error {
+	err := os.MkdirAll(s.Dir, 0755)
+	if err != nil {
+		return fmt.Errorf("error while creating spool directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return fmt.Errorf("error while reading spool directory: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.segments = s.segments[:0]
+	s.size = 0
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), segmentSuffix+tmpSuffix) {
+			err = os.Remove(filepath.Join(s.Dir, entry.Name()))
+			if err != nil {
+				return fmt.Errorf("error while removing temporary spool segment: %w", err)
+			}
+			continue
+		}
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("error while reading spool segment: %w", err)
+		}
+		s.segments = append(s.segments, segment{seq: seq, size: info.Size()})
+		s.size += info.Size()
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].seq < s.segments[j].seq
+	})
+	if len(s.segments) != 0 {
+		s.nextSeq = s.segments[len(s.segments)-1].seq + 1
+	}
+
+	return nil
+}
+
+// segmentPath - function, that returns path to segment file.
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+// Push - function for saving pool of metrics to the end of spool.
+// If size of spool exceeds maximum size, the oldest segments are removed.
+func (s *Spool) Push(metrics []data.Metrics) error {
+	metricsBytes, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+
+	content := binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(metricsBytes))
+	content = append(content, metricsBytes...)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	seq := s.nextSeq
+	s.nextSeq++
+
+	// segment is synced and renamed after writing, so that replay never reads partially written segment,
+	// and directory is synced, so that renamed segment is not lost after crash
+	tmpPath := s.segmentPath(seq) + tmpSuffix
+	err = writeSegment(tmpPath, content)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error while writing spool segment: %w", err)
+	}
+	err = os.Rename(tmpPath, s.segmentPath(seq))
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error while writing spool segment: %w", err)
+	}
+	err = syncDir(s.Dir)
+	if err != nil {
+		os.Remove(s.segmentPath(seq))
+		return fmt.Errorf("error while writing spool segment: %w", err)
+	}
+
+	s.segments = append(s.segments, segment{seq: seq, size: int64(len(content))})
+	s.size += int64(len(content))
+
+	for s.MaxBytes > 0 && s.size > s.MaxBytes && len(s.segments) != 0 {
+		s.removeLocked(s.segments[0].seq)
+		s.dropped++
+	}
+
+	return nil
+}
+
+// writeSegment - function for writing content to file and syncing it to disk.
+func writeSegment(path string, content []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	return errors.Join(err, file.Close())
+}
+
+// syncDir - function for syncing directory to disk, so that created and renamed files are saved.
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(file.Sync(), file.Close())
+}
+
+// removeLocked - function for removing segment from spool. Mutex must be locked by caller.
+func (s *Spool) removeLocked(seq uint64) {
+	for i, seg := range s.segments {
+		if seg.seq == seq {
+			os.Remove(s.segmentPath(seq))
+			s.size -= seg.size
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			return
+		}
+	}
+}
+
+// oldest - function, that reads the oldest segment of spool.
+// Segments with incorrect checksum are removed and counted as dropped.
+func (s *Spool) oldest() (uint64, []data.Metrics, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for len(s.segments) != 0 {
+		seq := s.segments[0].seq
+		content, err := os.ReadFile(s.segmentPath(seq))
+		if err == nil && len(content) >= 4 && binary.BigEndian.Uint32(content[:4]) == crc32.ChecksumIEEE(content[4:]) {
+			var metrics []data.Metrics
+			err = json.Unmarshal(content[4:], &metrics)
+			if err == nil {
+				return seq, metrics, true
+			}
+		}
+		s.removeLocked(seq)
+		s.dropped++
+	}
+
+	return 0, nil, false
+}
+
+// Replay - function for sending pools from spool in order, in which they were saved.
+// Replay stops on the first error, the pool, which was not sent, stays in spool.
+func (s *Spool) Replay(send func([]data.Metrics) error) error {
+	s.replayMutex.Lock()
+	defer s.replayMutex.Unlock()
+
+	return s.replay(send)
+}
+
+// Send - function for sending pool of metrics after all pools from spool,
+// so that server gets pools in order, in which they were collected.
+// If pools from spool or the pool itself were not sent, the pool is saved to the end of spool.
+// The function returns error of sending and flag, that the pool was saved to spool.
+func (s *Spool) Send(metrics []data.Metrics, send func([]data.Metrics) error) (bool, error) {
+	s.replayMutex.Lock()
+	defer s.replayMutex.Unlock()
+
+	err := s.replay(send)
+	if err == nil {
+		err = send(metrics)
+	}
+	if err == nil {
+		return false, nil
+	}
+
+	pushErr := s.Push(metrics)
+	if pushErr != nil {
+		return false, errors.Join(err, fmt.Errorf("error while saving metrics to spool: %w", pushErr))
+	}
+
+	return true, err
+}
+
+// replay - function for sending pools from spool. Replay mutex must be locked by caller.
+func (s *Spool) replay(send func([]data.Metrics) error) error {
+	for {
+		seq, metrics, ok := s.oldest()
+		if !ok {
+			return nil
+		}
+
+		err := send(metrics)
+		if err != nil {
+			return err
+		}
+
+		s.mutex.Lock()
+		s.removeLocked(seq)
+		s.mutex.Unlock()
+	}
+}
+
+// Size - function, that returns number of pools in spool and their size in bytes.
+func (s *Spool) Size() (int, int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.segments), s.size
+}
+
+// SelfMetrics - function, that returns metrics of spool: number of pools, size and number of dropped pools.
+// Dropped pools are counted from the previous call. If metrics were not delivered, dropped pools must be
+// given back with ReturnDropped, so that they are reported with the next pool.
+func (s *Spool) SelfMetrics() []data.Metrics {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	depth := float64(len(s.segments))
+	size := float64(s.size)
+	dropped := s.dropped
+	s.dropped = 0
+
+	return []data.Metrics{
+		{ID: "SpoolDepth", MType: "gauge", Value: &depth},
+		{ID: "SpoolBytes", MType: "gauge", Value: &size},
+		{ID: "SpoolDropped", MType: "counter", Delta: &dropped},
+	}
+}
+
+// ReturnDropped - function for giving back number of dropped pools from metrics of spool, that were not delivered.
+func (s *Spool) ReturnDropped(selfMetrics []data.Metrics) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, metric := range selfMetrics {
+		if metric.ID == "SpoolDropped" && metric.Delta != nil {
+			s.dropped += *metric.Delta
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package alerting
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+	retry "github.com/Tanya1515/metrics-collector.git/cmd/retry"
+	str "github.com/Tanya1515/metrics-collector.git/cmd/storage/structure"
+)
+
+func newStorage(t *testing.T) *str.MemStorage {
+	storage := &str.MemStorage{}
+	chanSh := make(chan struct{})
+	require.NoError(t, storage.Init(context.Background(), chanSh))
+
+	return storage
+}
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		rules     string
+		retention time.Duration
+		wantErr   bool
+	}{
+		{
+			name:  "test: load correct rules",
+			rules: `{"rules": [{"name": "HighHeap", "type": "threshold", "metric": "HeapAlloc", "op": ">", "threshold": 1e9, "for": "2m"}]}`,
+		},
+		{
+			name:    "test: load rule with unknown type",
+			rules:   `{"rules": [{"name": "HighHeap", "type": "test", "metric": "HeapAlloc", "op": ">"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "test: load rule with unknown operator",
+			rules:   `{"rules": [{"name": "HighHeap", "type": "threshold", "metric": "HeapAlloc", "op": "=>"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "test: load rate rule for gauge",
+			rules:   `{"rules": [{"name": "HeapRate", "type": "rate", "metric": "HeapAlloc", "metric_type": "gauge", "op": ">"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "test: load rules with the same name",
+			rules:   `{"rules": [{"name": "Absent", "type": "absent", "metric": "Alloc"}, {"name": "Absent", "type": "absent", "metric": "Alloc"}]}`,
+			wantErr: true,
+		},
+		{
+			name:      "test: load threshold rule with for longer than retention",
+			rules:     `{"rules": [{"name": "HighHeap", "type": "threshold", "metric": "HeapAlloc", "op": ">", "threshold": 1e9, "for": "2m"}]}`,
+			retention: time.Minute,
+		},
+		{
+			name:      "test: load rate rule with window longer than retention",
+			rules:     `{"rules": [{"name": "HeapRate", "type": "rate", "metric": "PollCount", "op": "<", "window": "2h"}]}`,
+			retention: time.Hour,
+			wantErr:   true,
+		},
+		{
+			name:      "test: load absent rule with default window longer than retention",
+			rules:     `{"rules": [{"name": "Absent", "type": "absent", "metric": "Alloc"}]}`,
+			retention: time.Minute,
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			require.NoError(t, os.WriteFile(path, []byte(test.rules), 0644))
+
+			rules, err := LoadRules(path, test.retention)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, rules, 1)
+			assert.Equal(t, "gauge", rules[0].MetricType)
+			assert.Equal(t, 2*time.Minute, rules[0].forDur)
+		})
+	}
+}
+
+func TestEvaluateThreshold(t *testing.T) {
+	storage := newStorage(t)
+	rule := Rule{Name: "HighHeap", Type: RuleThreshold, Metric: "HeapAlloc", Op: ">", Threshold: 100, For: "2m"}
+	require.NoError(t, rule.Validate())
+	engine := &Engine{Storage: storage, Rules: []Rule{rule}}
+
+	value := 150.0
+	require.NoError(t, storage.RepositoryAddAllValues([]data.Metrics{{ID: "HeapAlloc", MType: "gauge", Value: &value, Labels: map[string]string{"host": "a"}}}))
+
+	now := time.Now()
+	changed, err := engine.Evaluate(now)
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StatePending, changed[0].State)
+	assert.Equal(t, map[string]string{"host": "a"}, changed[0].Labels)
+
+	changed, err = engine.Evaluate(now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	changed, err = engine.Evaluate(now.Add(2 * time.Minute))
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateFiring, changed[0].State)
+	assert.Equal(t, 150.0, changed[0].Value)
+
+	require.NoError(t, storage.RepositoryAddAllValues([]data.Metrics{{ID: "HeapAlloc", MType: "gauge", Value: new(float64), Labels: map[string]string{"host": "a"}}}))
+
+	changed, err = engine.Evaluate(now.Add(3 * time.Minute))
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateResolved, changed[0].State)
+
+	alerts := engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateResolved, alerts[0].State)
+
+	_, err = engine.Evaluate(now.Add(3*time.Minute + ResolvedRetention + time.Second))
+	require.NoError(t, err)
+	assert.Empty(t, engine.Alerts())
+}
+
+func TestRunEvaluatesAtStart(t *testing.T) {
+	storage := newStorage(t)
+	rule := Rule{Name: "Absent", Type: RuleAbsent, Metric: "Alloc"}
+	require.NoError(t, rule.Validate())
+	engine := &Engine{Storage: storage, Rules: []Rule{rule}, Interval: time.Hour}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		alerts := engine.Alerts()
+		return len(alerts) == 1 && alerts[0].State == StateFiring
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestEvaluatePendingIsDropped(t *testing.T) {
+	storage := newStorage(t)
+	rule := Rule{Name: "HighHeap", Type: RuleThreshold, Metric: "HeapAlloc", Op: ">", Threshold: 100, For: "2m"}
+	require.NoError(t, rule.Validate())
+	engine := &Engine{Storage: storage, Rules: []Rule{rule}}
+
+	require.NoError(t, storage.RepositoryAddGaugeValue("HeapAlloc", 150))
+	_, err := engine.Evaluate(time.Now())
+	require.NoError(t, err)
+	require.Len(t, engine.Alerts(), 1)
+
+	require.NoError(t, storage.RepositoryAddGaugeValue("HeapAlloc", 50))
+	changed, err := engine.Evaluate(time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+	assert.Empty(t, engine.Alerts())
+}
+
+func TestEvaluateRate(t *testing.T) {
+	storage := newStorage(t)
+	rule := Rule{Name: "FastPollCount", Type: RuleRate, Metric: "PollCount", Op: ">", Threshold: 0.1, Window: "1m"}
+	require.NoError(t, rule.Validate())
+	engine := &Engine{Storage: storage, Rules: []Rule{rule}}
+
+	require.NoError(t, storage.RepositoryAddCounterValue("PollCount", 10))
+	require.NoError(t, storage.RepositoryAddCounterValue("PollCount", 12))
+
+	changed, err := engine.Evaluate(time.Now())
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateFiring, changed[0].State)
+	assert.InDelta(t, 0.2, changed[0].Value, 1e-9)
+}
+
+func TestEvaluateRateAcrossWindowStart(t *testing.T) {
+	storage := newStorage(t)
+	rule := Rule{Name: "FastPollCount", Type: RuleRate, Metric: "PollCount", Op: ">", Threshold: 0.1, Window: "1m"}
+	require.NoError(t, rule.Validate())
+	engine := &Engine{Storage: storage, Rules: []Rule{rule}}
+
+	require.NoError(t, storage.RepositoryAddCounterValue("PollCount", 10))
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, storage.RepositoryAddCounterValue("PollCount", 12))
+
+	// only the second point is in window, its increase is counted from the point before window
+	changed, err := engine.Evaluate(time.Now().Add(time.Minute - 25*time.Millisecond))
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateFiring, changed[0].State)
+	assert.InDelta(t, 0.2, changed[0].Value, 1e-9)
+}
+
+func TestEvaluateAbsent(t *testing.T) {
+	storage := newStorage(t)
+	rule := Rule{Name: "AgentDown", Type: RuleAbsent, Metric: "Alloc", Labels: map[string]string{"host": "a"}, Window: "1m"}
+	require.NoError(t, rule.Validate())
+	engine := &Engine{Storage: storage, Rules: []Rule{rule}}
+
+	changed, err := engine.Evaluate(time.Now())
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateFiring, changed[0].State)
+	assert.Equal(t, map[string]string{"host": "a"}, changed[0].Labels)
+
+	value := 1.0
+	require.NoError(t, storage.RepositoryAddAllValues([]data.Metrics{{ID: "Alloc", MType: "gauge", Value: &value, Labels: map[string]string{"host": "a"}}}))
+
+	changed, err = engine.Evaluate(time.Now())
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateResolved, changed[0].State)
+
+	changed, err = engine.Evaluate(time.Now().Add(2 * time.Minute))
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, StateFiring, changed[0].State)
+}
+
+func TestNotify(t *testing.T) {
+	received := make([]Alert, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		h := hmac.New(sha256.New, []byte("secret"))
+		h.Write(body)
+		assert.Equal(t, hex.EncodeToString(h.Sum(nil)), r.Header.Get("HashSHA256"))
+
+		var alert Alert
+		require.NoError(t, json.Unmarshal(body, &alert))
+		received = append(received, alert)
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notifier := &Notifier{URLs: []string{server.URL}, SecretKey: "secret", RepeatInterval: time.Hour}
+	now := time.Now()
+	firing := Alert{Rule: "HighHeap", Metric: "HeapAlloc", State: StateFiring}
+	pending := Alert{Rule: "HighHeap", Metric: "Alloc", State: StatePending}
+
+	require.NoError(t, notifier.Notify(context.Background(), []Alert{firing, pending}, now))
+	require.Len(t, received, 1)
+	assert.Equal(t, firing.Key(), received[0].Key())
+
+	require.NoError(t, notifier.Notify(context.Background(), []Alert{firing, pending}, now.Add(time.Minute)))
+	assert.Len(t, received, 1)
+
+	require.NoError(t, notifier.Notify(context.Background(), []Alert{firing}, now.Add(time.Hour)))
+	assert.Len(t, received, 2)
+
+	resolved := firing
+	resolved.State = StateResolved
+	require.NoError(t, notifier.Notify(context.Background(), []Alert{resolved}, now.Add(2*time.Hour)))
+	require.Len(t, received, 3)
+	assert.Equal(t, StateResolved, received[2].State)
+
+	require.NoError(t, notifier.Notify(context.Background(), []Alert{resolved}, now.Add(4*time.Hour)))
+	assert.Len(t, received, 3)
+}
+
+func TestNotifyError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+		rw.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	notifier := &Notifier{URLs: []string{server.URL}}
+	firing := Alert{Rule: "HighHeap", Metric: "HeapAlloc", State: StateFiring}
+
+	assert.Error(t, notifier.Notify(context.Background(), []Alert{firing}, time.Now()))
+	assert.Error(t, notifier.Notify(context.Background(), []Alert{firing}, time.Now()))
+	assert.Equal(t, 2, requests)
+}
+
+func TestNotifyRetryUnavailable(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	notifier := &Notifier{URLs: []string{server.URL}, RetryPolicy: retry.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond}}
+	firing := Alert{Rule: "HighHeap", Metric: "HeapAlloc", State: StateFiring}
+
+	require.NoError(t, notifier.Notify(context.Background(), []Alert{firing}, time.Now()))
+	assert.Equal(t, 2, requests)
+}
+
+func TestNotifyTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		<-release
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	firing := Alert{Rule: "HighHeap", Metric: "HeapAlloc", State: StateFiring}
+
+	notifier := &Notifier{URLs: []string{server.URL}, Timeout: 10 * time.Millisecond}
+	assert.Error(t, notifier.Notify(context.Background(), []Alert{firing}, time.Now()))
+
+	// retries stop, when context is canceled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	notifier = &Notifier{URLs: []string{server.URL}, RetryPolicy: retry.Policy{MaxAttempts: 3, BaseDelay: time.Hour}}
+	start := time.Now()
+	assert.Error(t, notifier.Notify(ctx, []Alert{firing}, time.Now()))
+	assert.Less(t, time.Since(start), time.Second)
+}
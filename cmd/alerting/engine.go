@@ -0,0 +1,316 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+	storage "github.com/Tanya1515/metrics-collector.git/cmd/storage"
+)
+
+// States of alert.
+const (
+	StatePending  = "pending"  // Condition of rule is true, but not longer than for duration of rule
+	StateFiring   = "firing"   // Condition of rule is true longer than for duration of rule
+	StateResolved = "resolved" // Condition of firing alert became false
+)
+
+// ResolvedRetention - time duration for displaying resolved alerts.
+const ResolvedRetention = 15 * time.Minute
+
+// DefaultInterval - default time duration between evaluations of rules.
+const DefaultInterval = 15 * time.Second
+
+// Alert - data type to describe state of alerting rule for one metric series.
+type Alert struct {
+	Rule       string            `json:"rule"`                  // Name of rule
+	Type       string            `json:"type"`                  // Type of rule
+	Metric     string            `json:"metric"`                // Name of metric
+	Labels     map[string]string `json:"labels,omitempty"`      // Labels of metric series
+	State      string            `json:"state"`                 // State of alert: pending, firing or resolved
+	Value      float64           `json:"value"`                 // Value of metric or rate during the last evaluation
+	ActiveAt   time.Time         `json:"active_at"`             // Time, when condition of rule became true
+	FiredAt    *time.Time        `json:"fired_at,omitempty"`    // Time, when alert started firing
+	ResolvedAt *time.Time        `json:"resolved_at,omitempty"` // Time, when alert was resolved
+}
+
+// Key - function, that returns unique key of alert: rule name and metric series.
+func (a Alert) Key() string {
+	return a.Rule + "/" + data.SeriesKey(a.Metric, a.Labels)
+}
+
+// Engine - data type to describe evaluation of alerting rules.
+type Engine struct {
+	Storage  storage.RepositoryInterface // Storage with metrics
+	Rules    []Rule                      // Validated alerting rules
+	Interval time.Duration               // Time duration between evaluations of rules
+	Logger   zap.SugaredLogger           // Engine logger
+	Notifier *Notifier                   // Notifier for delivering alerts to webhooks, nil if notifications are disabled
+	mutex    sync.Mutex
+	alerts   map[string]*Alert
+}
+
+// result - data type to describe result of rule condition for one metric series.
+type result struct {
+	labels map[string]string
+	value  float64
+	active bool
+}
+
+// notification - data type to describe alerts, that must be passed to notifier.
+type notification struct {
+	alerts []Alert
+	now    time.Time
+}
+
+// Run - function for evaluating rules at start and then every interval until context is canceled.
+// After every evaluation alerts are passed to notifier, if it is set.
+// Notifications are delivered in separate goroutine, so that slow webhooks do not delay evaluation of rules.
+func (e *Engine) Run(ctx context.Context) {
+	interval := e.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	var notifications chan notification
+	if e.Notifier != nil {
+		notifications = make(chan notification, 1)
+		go e.deliver(ctx, notifications)
+	}
+
+	e.evaluate(notifications)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.evaluate(notifications)
+		}
+	}
+}
+
+// evaluate - function for evaluating rules at the current moment and passing alerts to notifications, if channel is set.
+func (e *Engine) evaluate(notifications chan notification) {
+	now := time.Now()
+	_, err := e.Evaluate(now)
+	if err != nil {
+		e.Logger.Errorln("Error while evaluating alerting rules: ", err)
+	}
+	if notifications == nil {
+		return
+	}
+
+	current := notification{alerts: e.Alerts(), now: now}
+	select {
+	case notifications <- current:
+	default:
+		// notifier is still busy, alerts, which were not delivered yet, are replaced with the current ones
+		select {
+		case <-notifications:
+		default:
+		}
+		notifications <- current
+	}
+}
+
+// deliver - function for passing alerts to notifier until context is canceled.
+func (e *Engine) deliver(ctx context.Context, notifications <-chan notification) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case current := <-notifications:
+			err := e.Notifier.Notify(ctx, current.alerts, current.now)
+			if err != nil {
+				e.Logger.Errorln("Error while sending alert notifications: ", err)
+			}
+		}
+	}
+}
+
+// Evaluate - function for evaluating all rules at the moment now and updating state of alerts.
+// The function returns alerts, which state changed during evaluation.
+// If rule can not be evaluated, states of its alerts are not changed.
+func (e *Engine) Evaluate(now time.Time) ([]Alert, error) {
+	metrics, err := e.Storage.GetAllMetrics()
+	if err != nil {
+		return nil, fmt.Errorf("error while getting all metrics: %w", err)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.alerts == nil {
+		e.alerts = make(map[string]*Alert)
+	}
+
+	changed := make([]Alert, 0)
+	var errs []error
+	for i := range e.Rules {
+		rule := &e.Rules[i]
+		results, err := e.evaluateRule(rule, metrics, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error while evaluating rule %s: %w", rule.Name, err))
+			continue
+		}
+		changed = append(changed, e.updateAlerts(rule, results, now)...)
+	}
+
+	for key, alert := range e.alerts {
+		if alert.State == StateResolved && now.Sub(*alert.ResolvedAt) > ResolvedRetention {
+			delete(e.alerts, key)
+		}
+	}
+
+	return changed, errors.Join(errs...)
+}
+
+// Alerts - function, that returns current alerts sorted by key.
+func (e *Engine) Alerts() []Alert {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, alert := range e.alerts {
+		alerts = append(alerts, *alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Key() < alerts[j].Key()
+	})
+
+	return alerts
+}
+
+// evaluateRule - function, that checks condition of rule for every matching metric series.
+func (e *Engine) evaluateRule(rule *Rule, metrics []data.Metrics, now time.Time) ([]result, error) {
+	results := make([]result, 0)
+	for _, metric := range metrics {
+		if metric.ID != rule.Metric || metric.MType != rule.MetricType || !rule.matchLabels(metric.Labels) {
+			continue
+		}
+
+		switch rule.Type {
+		case RuleThreshold:
+			value := 0.0
+			if metric.Delta != nil {
+				value = float64(*metric.Delta)
+			} else if metric.Value != nil {
+				value = *metric.Value
+			}
+			active, _ := compare(rule.Op, value, rule.Threshold)
+			results = append(results, result{labels: metric.Labels, value: value, active: active})
+		case RuleRate:
+			// range query with rate aggregation counts increase from the last point before window too,
+			// so that rate of sparse counter is not underestimated
+			points, err := e.Storage.GetMetricRange(data.RangeQuery{
+				ID:          metric.ID,
+				MType:       metric.MType,
+				Labels:      metric.Labels,
+				From:        now.Add(-rule.windowDur),
+				To:          now,
+				Step:        rule.windowDur,
+				Aggregation: data.AggregationRate,
+			})
+			if err != nil {
+				return nil, err
+			}
+			value := windowRate(points)
+			active, _ := compare(rule.Op, value, rule.Threshold)
+			results = append(results, result{labels: metric.Labels, value: value, active: active})
+		case RuleAbsent:
+			history, err := e.Storage.GetMetricHistory(metric.MType, metric.ID, metric.Labels, now.Add(-rule.windowDur), now)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, result{labels: metric.Labels, active: len(history) == 0})
+		}
+	}
+
+	// metric, which was never reported, is absent too
+	if rule.Type == RuleAbsent && len(results) == 0 {
+		results = append(results, result{labels: data.CopyLabels(rule.Labels), active: true})
+	}
+
+	return results, nil
+}
+
+// windowRate - function, that sums per-second increase of counter during window from points of range query.
+// Point, which is saved exactly at the end of window, gets its own step, so there can be two points.
+func windowRate(points []data.Point) float64 {
+	var rate float64
+	for _, point := range points {
+		rate += point.Value
+	}
+
+	return rate
+}
+
+// updateAlerts - function for moving alerts of rule through states. Mutex must be locked by caller.
+func (e *Engine) updateAlerts(rule *Rule, results []result, now time.Time) []Alert {
+	changed := make([]Alert, 0)
+	seen := make(map[string]struct{}, len(results))
+
+	for _, res := range results {
+		alert := &Alert{Rule: rule.Name, Type: rule.Type, Metric: rule.Metric, Labels: res.labels}
+		key := alert.Key()
+		seen[key] = struct{}{}
+
+		current, ok := e.alerts[key]
+		if !res.active {
+			if ok && current.State != StateResolved {
+				e.resolve(key, current, now, &changed)
+			}
+			continue
+		}
+
+		if !ok || current.State == StateResolved {
+			alert.State = StatePending
+			alert.ActiveAt = now
+			e.alerts[key] = alert
+			current = alert
+			if rule.forDur != 0 {
+				changed = append(changed, *current)
+			}
+		}
+
+		current.Value = res.value
+		if current.State == StatePending && now.Sub(current.ActiveAt) >= rule.forDur {
+			firedAt := now
+			current.State = StateFiring
+			current.FiredAt = &firedAt
+			changed = append(changed, *current)
+		}
+	}
+
+	// series, which disappeared from storage, do not satisfy condition of rule
+	for key, current := range e.alerts {
+		if _, ok := seen[key]; ok || current.Rule != rule.Name || current.State == StateResolved {
+			continue
+		}
+		e.resolve(key, current, now, &changed)
+	}
+
+	return changed
+}
+
+// resolve - function, that resolves firing alert and removes pending alert. Mutex must be locked by caller.
+func (e *Engine) resolve(key string, alert *Alert, now time.Time, changed *[]Alert) {
+	if alert.State == StatePending {
+		delete(e.alerts, key)
+		return
+	}
+
+	resolvedAt := now
+	alert.State = StateResolved
+	alert.ResolvedAt = &resolvedAt
+	*changed = append(*changed, *alert)
+}
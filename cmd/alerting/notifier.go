@@ -0,0 +1,127 @@
+package alerting
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	retryerr "github.com/Tanya1515/metrics-collector.git/cmd/errors"
+	retry "github.com/Tanya1515/metrics-collector.git/cmd/retry"
+)
+
+// DefaultNotifyTimeout - default time duration of one request to webhook.
+const DefaultNotifyTimeout = 10 * time.Second
+
+// Notifier - data type to describe delivery of alert notifications to webhooks.
+type Notifier struct {
+	URLs           []string      // Webhook URLs for sending notifications
+	SecretKey      string        // Key for signing notifications
+	RepeatInterval time.Duration // Time duration for repeating notification about firing alert, 0 - do not repeat
+	RetryPolicy    retry.Policy  // Policy of repeating notifications, that failed with temporary errors
+	Timeout        time.Duration // Time duration of one request to webhook, DefaultNotifyTimeout if 0
+	mutex          sync.Mutex
+	client         *resty.Client
+	sent           map[string]delivery
+}
+
+// delivery - data type to describe the last notification, delivered to webhook.
+type delivery struct {
+	state  string
+	sentAt time.Time
+}
+
+// Notify - function for sending firing and resolved alerts to all webhooks.
+// Alert is sent again only if its state changed or repeat interval passed since the last delivery.
+// The function must receive all current alerts, deliveries of missing alerts are forgotten.
+// Sending and waiting between retries stop, when context is canceled.
+func (n *Notifier) Notify(ctx context.Context, alerts []Alert, now time.Time) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.client == nil {
+		timeout := n.Timeout
+		if timeout <= 0 {
+			timeout = DefaultNotifyTimeout
+		}
+		n.client = resty.New().SetTimeout(timeout)
+	}
+	if n.sent == nil {
+		n.sent = make(map[string]delivery)
+	}
+
+	current := make(map[string]struct{}, len(alerts)*len(n.URLs))
+	var errs []error
+	for _, alert := range alerts {
+		if alert.State != StateFiring && alert.State != StateResolved {
+			continue
+		}
+
+		var body []byte
+		for _, url := range n.URLs {
+			key := url + " " + alert.Key()
+			current[key] = struct{}{}
+
+			last, ok := n.sent[key]
+			if ok && last.state == alert.State && (alert.State == StateResolved || n.RepeatInterval == 0 || now.Sub(last.sentAt) < n.RepeatInterval) {
+				continue
+			}
+			// resolved alert, which firing was not delivered, is not interesting for receiver
+			if !ok && alert.State == StateResolved {
+				n.sent[key] = delivery{state: alert.State, sentAt: now}
+				continue
+			}
+
+			if body == nil {
+				var err error
+				body, err = json.Marshal(alert)
+				if err != nil {
+					return fmt.Errorf("error during serialization of alert %s: %w", alert.Key(), err)
+				}
+			}
+
+			err := n.send(ctx, url, body)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("error while sending alert %s to %s: %w", alert.Key(), url, err))
+				continue
+			}
+			n.sent[key] = delivery{state: alert.State, sentAt: now}
+		}
+	}
+
+	for key := range n.sent {
+		if _, ok := current[key]; !ok {
+			delete(n.sent, key)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// send - function for sending signed notification to webhook with retries.
+func (n *Notifier) send(ctx context.Context, url string, body []byte) error {
+	request := n.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body)
+	if n.SecretKey != "" {
+		h := hmac.New(sha256.New, []byte(n.SecretKey))
+		h.Write(body)
+		request.SetHeader("HashSHA256", hex.EncodeToString(h.Sum(nil)))
+	}
+
+	return retry.Do(ctx, n.RetryPolicy, func() error {
+		response, err := request.Post(url)
+		if err == nil && response.IsError() {
+			return fmt.Errorf("webhook: %w", retryerr.NewStatusError(response.StatusCode(), response.Header(), time.Now()))
+		}
+		return err
+	})
+}
@@ -0,0 +1,189 @@
+// Alerting - package for evaluating alerting rules against stored metrics.
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Types of alerting rules.
+const (
+	RuleThreshold = "threshold" // Rule fires, when metric value satisfies comparison with threshold
+	RuleRate      = "rate"      // Rule fires, when per-second increase of counter satisfies comparison with threshold
+	RuleAbsent    = "absent"    // Rule fires, when metric was not reported during window
+)
+
+// Rule - data type to describe alerting rule.
+type Rule struct {
+	Name       string            `json:"name"`                  // Unique name of the rule
+	Type       string            `json:"type"`                  // Type of the rule: threshold, rate or absent
+	Metric     string            `json:"metric"`                // Name of metric
+	MetricType string            `json:"metric_type,omitempty"` // Type of metric: gauge or counter
+	Labels     map[string]string `json:"labels,omitempty"`      // Labels, that metric series must have for matching the rule
+	Op         string            `json:"op,omitempty"`          // Comparison operator: >, >=, <, <=, ==, !=
+	Threshold  float64           `json:"threshold,omitempty"`   // Value for comparison
+	For        string            `json:"for,omitempty"`         // Time duration, during which condition must be true before alert fires
+	Window     string            `json:"window,omitempty"`      // Time duration for calculating rate or checking absence
+	forDur     time.Duration
+	windowDur  time.Duration
+}
+
+// RulesFile - data type to describe file with alerting rules.
+type RulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadRules - function for reading and validating alerting rules from JSON file.
+// Retention is time duration for keeping metrics history in storage, 0 means history is kept forever.
+func LoadRules(path string, retention time.Duration) ([]Rule, error) {
+	rulesBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading rules file: %w", err)
+	}
+
+	rulesFile := RulesFile{}
+	err = json.Unmarshal(rulesBytes, &rulesFile)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshaling rules file: %w", err)
+	}
+
+	names := make(map[string]struct{}, len(rulesFile.Rules))
+	for i := range rulesFile.Rules {
+		err = rulesFile.Rules[i].Validate()
+		if err != nil {
+			return nil, err
+		}
+		err = rulesFile.Rules[i].CheckRetention(retention)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := names[rulesFile.Rules[i].Name]; ok {
+			return nil, fmt.Errorf("rule %s is defined more than once", rulesFile.Rules[i].Name)
+		}
+		names[rulesFile.Rules[i].Name] = struct{}{}
+	}
+
+	return rulesFile.Rules, nil
+}
+
+// parseRuleDuration - function, that parses duration of rule, empty duration is equal to zero.
+func parseRuleDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("negative duration %s", value)
+	}
+
+	return duration, nil
+}
+
+// Validate - function, that checks rule fields, sets default values and parses durations.
+func (r *Rule) Validate() error {
+	var err error
+
+	if r.Name == "" {
+		return fmt.Errorf("rule name is empty")
+	}
+	if r.Metric == "" {
+		return fmt.Errorf("metric name of rule %s is empty", r.Name)
+	}
+
+	r.forDur, err = parseRuleDuration(r.For)
+	if err != nil {
+		return fmt.Errorf("invalid for of rule %s: %w", r.Name, err)
+	}
+	r.windowDur, err = parseRuleDuration(r.Window)
+	if err != nil {
+		return fmt.Errorf("invalid window of rule %s: %w", r.Name, err)
+	}
+
+	switch r.Type {
+	case RuleThreshold:
+		if r.MetricType == "" {
+			r.MetricType = "gauge"
+		}
+	case RuleRate:
+		if r.MetricType == "" {
+			r.MetricType = "counter"
+		}
+		if r.MetricType != "counter" {
+			return fmt.Errorf("rate rule %s can be used only for counter metrics", r.Name)
+		}
+		if r.windowDur == 0 {
+			r.windowDur = time.Minute
+		}
+	case RuleAbsent:
+		if r.MetricType == "" {
+			r.MetricType = "gauge"
+		}
+		if r.windowDur == 0 {
+			r.windowDur = 5 * time.Minute
+		}
+	default:
+		return fmt.Errorf("invalid type of rule %s: %s", r.Name, r.Type)
+	}
+
+	if r.MetricType != "gauge" && r.MetricType != "counter" {
+		return fmt.Errorf("invalid metric type of rule %s: %s", r.Name, r.MetricType)
+	}
+
+	if r.Type != RuleAbsent {
+		if _, err := compare(r.Op, 0, 0); err != nil {
+			return fmt.Errorf("invalid operator of rule %s: %w", r.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// CheckRetention - function, that checks, that window of rate and absent rule does not exceed retention of metrics history.
+// Points older than retention are removed, so rate for longer window is underestimated. Retention 0 means history is kept forever.
+func (r *Rule) CheckRetention(retention time.Duration) error {
+	if retention <= 0 || (r.Type != RuleRate && r.Type != RuleAbsent) {
+		return nil
+	}
+	if r.windowDur > retention {
+		return fmt.Errorf("window of rule %s exceeds retention of metrics history %s", r.Name, retention)
+	}
+
+	return nil
+}
+
+// compare - function, that compares value with threshold using operator.
+func compare(op string, value float64, threshold float64) (bool, error) {
+	switch op {
+	case ">":
+		return value > threshold, nil
+	case ">=":
+		return value >= threshold, nil
+	case "<":
+		return value < threshold, nil
+	case "<=":
+		return value <= threshold, nil
+	case "==":
+		return value == threshold, nil
+	case "!=":
+		return value != threshold, nil
+	}
+
+	return false, fmt.Errorf("unknown operator %q", op)
+}
+
+// matchLabels - function, that checks if series labels contain all labels of rule.
+func (r *Rule) matchLabels(labels map[string]string) bool {
+	for name, value := range r.Labels {
+		if labels[name] != value {
+			return false
+		}
+	}
+
+	return true
+}
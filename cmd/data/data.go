@@ -4,14 +4,18 @@ package data
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/binary"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type Middleware func(http.HandlerFunc) http.HandlerFunc
@@ -24,35 +28,136 @@ type ResultMetrics struct {
 
 // Metrics - type, that describes all fields of recieved/saved metrics.
 type Metrics struct {
-	ID    string   `json:"id"`              // Metric name
-	MType string   `json:"type"`            // Metric Type (counter or gauge)
-	Delta *int64   `json:"delta,omitempty"` // Counter value
-	Value *float64 `json:"value,omitempty"` // Gauge Value
+	ID     string            `json:"id"`               // Metric name
+	MType  string            `json:"type"`             // Metric Type (counter or gauge)
+	Delta  *int64            `json:"delta,omitempty"`  // Counter value
+	Value  *float64          `json:"value,omitempty"`  // Gauge Value
+	Labels map[string]string `json:"labels,omitempty"` // Metric labels, metric name, type and labels identify the series
+}
+
+// UpdatesResponse - type, that describes response of server for saved pool of metrics.
+type UpdatesResponse struct {
+	Count int `json:"count"` // Number of saved metrics
+}
+
+// Sample - type, that describes one timestamped point of metric history.
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`       // Time, when the value was saved
+	Delta     *int64    `json:"delta,omitempty"` // Counter value (total sum) at the moment
+	Value     *float64  `json:"value,omitempty"` // Gauge value at the moment
+}
+
+// Point - type, that describes one aggregated point of metric series.
+type Point struct {
+	Timestamp time.Time `json:"timestamp"` // Start of the step
+	Value     float64   `json:"value"`     // Aggregated value of the step
+}
+
+// Series - type, that describes result of range query for one metric.
+type Series struct {
+	ID          string            `json:"id"`               // Metric name
+	MType       string            `json:"type"`             // Metric Type (counter or gauge)
+	Labels      map[string]string `json:"labels,omitempty"` // Metric labels
+	Aggregation string            `json:"aggregation"`      // Aggregation function, that was applied for every step
+	Step        string            `json:"step"`             // Time duration of one step
+	Points      []Point           `json:"points"`           // Aggregated points
 }
 
 // ConfigApp - type, that describes all fields of the application config file
 type ConfigApp struct {
-	ServerAddress string `json:"address"`        // Server address
-	StoreInterval string `json:"store_interval"` // Time duration for saving metrics
-	FileStorePath string `json:"store_file"`     // Filename for storing metrics
-	Restore       bool   `json:"restore"`        // Flag for storing all info
-	PostgreSQL    string `json:"database_dsn"`   // Credentials for database
-	SecretKey     string `json:"secret_key"`     // Secret key for hashing data
-	CryptoKeyPath string `json:"crypto_key"`     // Path to key for asymmetrical encryption
+	ServerAddress  string      `json:"address"`               // Server address
+	StoreInterval  string      `json:"store_interval"`        // Time duration for saving metrics
+	FileStorePath  string      `json:"store_file"`            // Filename for storing metrics
+	Restore        bool        `json:"restore"`               // Flag for storing all info
+	PostgreSQL     string      `json:"database_dsn"`          // Credentials for database
+	SecretKey      string      `json:"secret_key"`            // Secret key for hashing data
+	CryptoKeyPath  string      `json:"crypto_key"`            // Path to key for asymmetrical encryption
+	Retention      string      `json:"retention"`             // Time duration for keeping metrics history
+	RulesFile      string      `json:"rules_file"`            // Path to file with alerting rules
+	RulesInterval  string      `json:"rules_interval"`        // Time duration between evaluations of alerting rules
+	WebhookURLs    []string    `json:"webhook_urls"`          // Webhook URLs for sending alert notifications
+	AlertRepeat    string      `json:"alert_repeat_interval"` // Time duration for repeating notifications about firing alerts
+	GRPCAddress    string      `json:"grpc_address"`          // Address of gRPC server
+	Retry          RetryConfig `json:"retry"`                 // Policy of repeating storage operations
+	MaxClockSkew   string      `json:"max_clock_skew"`        // Maximum difference between timestamp of signed request and server time
+	NonceCacheSize int         `json:"nonce_cache_size"`      // Maximum number of remembered nonces of signed requests
 }
 
 // ConfigAgent - type, that describes all fields of the agent configuration
 type ConfigAgent struct {
-	ReportInterval      string `json:"report_interval"` // Time duration for saving metrics
-	PollInterval        string `json:"poll_interval"`   // Time duration for getting
-	ServerAddress       string `json:"address"`         // Address for sending metrics
-	SecretKey           string `json:"secret_key"`      // Secret hash for creating hash
-	CryptoKeyPath       string `json:"crypto_key"`      // Requests linit for server
-	LimitServerRequests int    `json:"limit_requests"`  // Key path for assymetrical encryption
+	ReportInterval      string                     `json:"report_interval"` // Time duration for saving metrics
+	PollInterval        string                     `json:"poll_interval"`   // Time duration for getting
+	ServerAddress       string                     `json:"address"`         // Address for sending metrics, several addresses are separated by comma
+	SecretKey           string                     `json:"secret_key"`      // Secret hash for creating hash
+	CryptoKeyPath       string                     `json:"crypto_key"`      // Requests linit for server
+	LimitServerRequests int                        `json:"limit_requests"`  // Key path for assymetrical encryption
+	Host                string                     `json:"host"`            // Host name, that is sent as label of every metric, hostname of the machine by default, "-" - do not send host label
+	InstanceID          string                     `json:"instance_id"`     // Identifier of agent instance, that is sent as label of every metric
+	Env                 string                     `json:"env"`             // Environment name, that is sent as label of every metric
+	Labels              map[string]string          `json:"labels"`          // Additional labels, that are sent with every metric
+	Transport           string                     `json:"transport"`       // Transport for sending metrics: http or grpc
+	GRPCAddress         string                     `json:"grpc_address"`    // Address of gRPC server
+	SpoolDir            string                     `json:"spool_dir"`       // Directory for saving metrics, that were not sent to server
+	SpoolMaxBytes       int64                      `json:"spool_max_bytes"` // Maximum size of spool in bytes
+	Collectors          map[string]CollectorConfig `json:"collectors"`      // Settings of collectors by name
+	DebugAddress        string                     `json:"debug_address"`   // Address of debug endpoint with the latest batch and status of agent
+	Strategy            string                     `json:"send_strategy"`   // Strategy of sending metrics to several servers: failover or fanout
+	Retry               RetryConfig                `json:"retry"`           // Policy of repeating requests to server
+}
+
+// RetryConfig - type, that describes policy of repeating operations, that failed with temporary errors
+type RetryConfig struct {
+	MaxAttempts int     `json:"max_attempts"` // Maximum number of attempts, including the first one
+	BaseDelay   string  `json:"base_delay"`   // Delay before the second attempt
+	MaxDelay    string  `json:"max_delay"`    // Maximum delay between attempts
+	Multiplier  float64 `json:"multiplier"`   // Multiplier of delay after every attempt
+	Jitter      bool    `json:"jitter"`       // Flag for random delay between 0 and computed delay
+	Deadline    string  `json:"deadline"`     // Time duration of all attempts with delays
+}
+
+// CollectorConfig - type, that describes settings of agent collector
+type CollectorConfig struct {
+	Enabled        *bool            `json:"enabled"`          // Flag for running collector, default value depends on collector
+	Interval       string           `json:"interval"`         // Time duration for collecting metrics, poll interval by default
+	Include        []string         `json:"include"`          // Patterns of objects for collecting, such as mount points, all objects by default
+	Exclude        []string         `json:"exclude"`          // Patterns of objects, which are skipped
+	IncludeFSTypes []string         `json:"include_fs_types"` // Patterns of filesystem types for collecting, all types by default
+	ExcludeFSTypes []string         `json:"exclude_fs_types"` // Patterns of filesystem types, which are skipped, virtual filesystems by default
+	Processes      []ProcessMatcher `json:"processes"`        // Matchers of processes for collecting their metrics
+	CgroupPath     string           `json:"cgroup_path"`      // Path of cgroup relative to cgroup v2 mount point, cgroup of agent by default
+	Scripts        []ScriptConfig   `json:"scripts"`          // Commands, which output is parsed as metrics
+	UDPAddress     string           `json:"udp_address"`      // Address of UDP listener for receiving metrics
+	TCPAddress     string           `json:"tcp_address"`      // Address of TCP listener for receiving metrics, listener is disabled if address is empty
+}
+
+// ScriptConfig - type, that describes command for collecting custom metrics
+type ScriptConfig struct {
+	Name    string   `json:"name"`    // Name of script, that is sent as script label of its self-metrics
+	Command []string `json:"command"` // Executable and its arguments
+	Timeout string   `json:"timeout"` // Time duration for running command
+	Format  string   `json:"format"`  // Format of output: json, text or empty for detecting format
+}
+
+// ProcessMatcher - type, that describes rule for finding processes, exactly one way of matching must be set
+type ProcessMatcher struct {
+	Name    string `json:"name"`    // Name of matcher, that is sent as process label
+	Process string `json:"process"` // Name of process executable
+	Cmdline string `json:"cmdline"` // Regular expression for command line of process
+	Pidfile string `json:"pidfile"` // Path to file with process identifier
 }
 
 // Compress - function for compressing list of metrics to slice of bytes
 func Compress(metricData *[]Metrics) ([]byte, error) {
+	metricDataBytes, err := json.Marshal(metricData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal data: %w", err)
+	}
+
+	return CompressBytes(metricDataBytes)
+}
+
+// CompressBytes - function for compressing serialized data with gzip.
+func CompressBytes(body []byte) ([]byte, error) {
 	var b bytes.Buffer
 
 	w, err := gzip.NewWriterLevel(&b, gzip.BestCompression)
@@ -60,11 +165,7 @@ func Compress(metricData *[]Metrics) ([]byte, error) {
 		return nil, fmt.Errorf("failed init compress writer: %w", err)
 	}
 
-	metricDataBytes, err := json.Marshal(metricData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal data: %w", err)
-	}
-	_, err = w.Write(metricDataBytes)
+	_, err = w.Write(body)
 	if err != nil {
 		return nil, fmt.Errorf("failed write data to compress temporary buffer: %w", err)
 	}
@@ -77,8 +178,17 @@ func Compress(metricData *[]Metrics) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
-// EncryptData - function for encrypting metricData
-func EncryptData(data []byte, publicKeyStr []byte) ([]byte, error) {
+// Values of X-Encrypted header, that describe encryption scheme of request body.
+const (
+	EncryptionRSA    = "rsa"         // Body is encrypted with RSA-OAEP directly, size of body is limited by size of key
+	EncryptionHybrid = "rsa-aes-gcm" // Body is encrypted with AES-256-GCM, AES key is encrypted with RSA-OAEP
+)
+
+// hybridVersion - version of format of data, encrypted with hybrid scheme.
+const hybridVersion byte = 1
+
+// parsePublicKey - function for parsing RSA public key in PEM format.
+func parsePublicKey(publicKeyStr []byte) (*rsa.PublicKey, error) {
 	block, _ := pem.Decode(publicKeyStr)
 	if block == nil {
 		return nil, fmt.Errorf("failed to decode PEM block")
@@ -98,6 +208,73 @@ func EncryptData(data []byte, publicKeyStr []byte) ([]byte, error) {
 		return nil, fmt.Errorf("not an RSA public key")
 	}
 
+	return rsaPub, nil
+}
+
+// parsePrivateKey - function for parsing RSA private key in PEM format.
+func parsePrivateKey(privateKeyStr string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privateKeyStr))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// EncryptData - function for encrypting metricData with hybrid scheme.
+// Data is encrypted with random AES-256-GCM key, the key is encrypted with RSA-OAEP.
+// Result has format: version (1 byte), length of encrypted key (2 bytes), encrypted key, nonce, encrypted data.
+func EncryptData(data []byte, publicKeyStr []byte) ([]byte, error) {
+	rsaPub, err := parsePublicKey(publicKeyStr)
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaPub, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext := make([]byte, 0, 3+len(encryptedKey)+len(nonce)+len(data)+gcm.Overhead())
+	ciphertext = append(ciphertext, hybridVersion)
+	ciphertext = binary.BigEndian.AppendUint16(ciphertext, uint16(len(encryptedKey)))
+	ciphertext = append(ciphertext, encryptedKey...)
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = gcm.Seal(ciphertext, nonce, data, nil)
+
+	return ciphertext, nil
+}
+
+// EncryptDataRSA - function for encrypting metricData with RSA-OAEP directly.
+// Size of data must be less than size of key.
+func EncryptDataRSA(data []byte, publicKeyStr []byte) ([]byte, error) {
+	rsaPub, err := parsePublicKey(publicKeyStr)
+	if err != nil {
+		return nil, err
+	}
+
 	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaPub, data, nil)
 	if err != nil {
 		return nil, err
@@ -106,11 +283,56 @@ func EncryptData(data []byte, publicKeyStr []byte) ([]byte, error) {
 	return ciphertext, nil
 }
 
-// DecryptData - function for decrypting data
+// DecryptData - function for decrypting data, encrypted with hybrid scheme.
 func DecryptData(privateKeyStr string, data []byte) ([]byte, error) {
+	privateKey, err := parsePrivateKey(privateKeyStr)
+	if err != nil {
+		return nil, err
+	}
 
-	block, _ := pem.Decode([]byte(privateKeyStr))
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if len(data) < 3 {
+		return nil, fmt.Errorf("encrypted data is too short")
+	}
+	if data[0] != hybridVersion {
+		return nil, fmt.Errorf("unsupported version of encrypted data: %d", data[0])
+	}
+
+	keyLength := int(binary.BigEndian.Uint16(data[1:3]))
+	data = data[3:]
+	if len(data) < keyLength {
+		return nil, fmt.Errorf("encrypted data is too short")
+	}
+
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, data[:keyLength], nil)
+	if err != nil {
+		return nil, err
+	}
+	data = data[keyLength:]
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted data is too short")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+// DecryptDataRSA - function for decrypting data, encrypted with RSA-OAEP directly.
+func DecryptDataRSA(privateKeyStr string, data []byte) ([]byte, error) {
+	privateKey, err := parsePrivateKey(privateKeyStr)
 	if err != nil {
 		return nil, err
 	}
@@ -3,8 +3,15 @@ package data
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -36,4 +43,216 @@ func TestCompress(t *testing.T) {
 		assert.Equal(t, "TestGaugeAll", (metricsResult[1].ID))
 	})
 
+	t.Run("Test compressing serialized data:", func(t *testing.T) {
+		body := []byte(`[{"id":"TestGaugeAll","type":"gauge","value":101.101}]`)
+		result, err := CompressBytes(body)
+		require.NoError(t, err)
+
+		gz, err := gzip.NewReader(bytes.NewReader(result))
+		require.NoError(t, err)
+
+		unpacked, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		assert.Equal(t, body, unpacked)
+	})
+}
+
+func TestSanitizePrometheusName(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric string
+		result string
+	}{
+		{name: "test: valid name", metric: "HeapAlloc", result: "HeapAlloc"},
+		{name: "test: name with dots and dashes", metric: "cpu.util-total", result: "cpu_util_total"},
+		{name: "test: name starting with digit", metric: "1min", result: "_1min"},
+		{name: "test: name with colon", metric: "job:requests", result: "job:requests"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.result, SanitizePrometheusName(test.metric))
+		})
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	var buf bytes.Buffer
+	var delta int64 = 3
+	value := math.Inf(1)
+	metrics := []Metrics{
+		{ID: "Gauge\nname", MType: "gauge", Value: &value},
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+		{ID: "PollCount", MType: "gauge", Value: &value},
+	}
+
+	require.NoError(t, WritePrometheus(&buf, metrics))
+	assert.Equal(t, "# HELP Gauge_name Metric Gauge\\nname\n"+
+		"# TYPE Gauge_name gauge\n"+
+		"Gauge_name +Inf\n"+
+		"# TYPE PollCount counter\n"+
+		"PollCount 3\n", buf.String())
+}
+
+func TestSeriesKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		result string
+	}{
+		{name: "test: metric without labels", labels: nil, result: "PollCount"},
+		{name: "test: labels are sorted", labels: map[string]string{"host": "a", "env": "prod"}, result: `PollCount{env="prod",host="a"}`},
+		{name: "test: label value with quotes", labels: map[string]string{"host": `a"b`}, result: `PollCount{host="a\"b"}`},
+		{name: "test: label name with quotes", labels: map[string]string{`a="x",b`: "y"}, result: `PollCount{a=\"x\",b="y"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.result, SeriesKey("PollCount", test.labels))
+		})
+	}
+}
+
+func TestSeriesKeyUnique(t *testing.T) {
+	assert.NotEqual(t, SeriesKey("PollCount", map[string]string{`a="x",b`: "y"}), SeriesKey("PollCount", map[string]string{"a": "x", "b": "y"}))
+	assert.NotEqual(t, SeriesKey(`x{a="1"}`, nil), SeriesKey("x", map[string]string{"a": "1"}))
+	assert.NotEqual(t, SeriesKey(`x\`, map[string]string{"a": "1"}), SeriesKey(`x\{a="1"}`, nil))
+	assert.Equal(t, `x\{a="1"}`, SeriesKey(`x{a="1"}`, nil))
+}
+
+func TestLabelsString(t *testing.T) {
+	labels := map[string]string{"host": "a", "env": "prod"}
+
+	labelsString := LabelsString(labels)
+	assert.Equal(t, `{"env":"prod","host":"a"}`, labelsString)
+
+	parsedLabels, err := ParseLabelsString(labelsString)
+	require.NoError(t, err)
+	assert.Equal(t, labels, parsedLabels)
+
+	assert.Equal(t, "", LabelsString(map[string]string{}))
+}
+
+func TestWritePrometheusLabels(t *testing.T) {
+	var buf bytes.Buffer
+	var deltaA int64 = 1
+	var deltaB int64 = 2
+	metrics := []Metrics{
+		{ID: "PollCount", MType: "counter", Delta: &deltaB, Labels: map[string]string{"host": "b"}},
+		{ID: "PollCount", MType: "counter", Delta: &deltaA, Labels: map[string]string{"host": "a", "env.name": "prod"}},
+	}
+
+	require.NoError(t, WritePrometheus(&buf, metrics))
+	assert.Equal(t, "# TYPE PollCount counter\n"+
+		"PollCount{env_name=\"prod\",host=\"a\"} 1\n"+
+		"PollCount{host=\"b\"} 2\n", buf.String())
+}
+
+func TestWritePrometheusCollisions(t *testing.T) {
+	var buf bytes.Buffer
+	first := 1.0
+	second := 2.0
+	third := 3.0
+	metrics := []Metrics{
+		{ID: "a.b", MType: "gauge", Value: &second},
+		{ID: "a-b", MType: "gauge", Value: &first},
+		{ID: "a.b", MType: "gauge", Value: &third, Labels: map[string]string{"host": "a"}},
+		{ID: "a_b", MType: "gauge", Value: &third, Labels: map[string]string{"env.name": "b", "env-name": "a"}},
+	}
+
+	require.NoError(t, WritePrometheus(&buf, metrics))
+	assert.Equal(t, "# HELP a_b Metric a-b\n"+
+		"# TYPE a_b gauge\n"+
+		"a_b 1\n"+
+		"a_b{env_name=\"a\"} 3\n"+
+		"a_b{host=\"a\"} 3\n", buf.String())
+}
+
+func generateTestKeys(t *testing.T) (string, []byte) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+
+	return string(privateKeyPEM), publicKeyPEM
+}
+
+func TestEncryptData(t *testing.T) {
+	privateKey, publicKey := generateTestKeys(t)
+	plaintext := bytes.Repeat([]byte("metrics"), 1000)
+
+	ciphertext, err := EncryptData(plaintext, publicKey)
+	require.NoError(t, err)
+
+	result, err := DecryptData(privateKey, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, result)
+
+	ciphertext[len(ciphertext)-1] ^= 1
+	_, err = DecryptData(privateKey, ciphertext)
+	assert.Error(t, err)
+
+	_, err = EncryptDataRSA(plaintext, publicKey)
+	assert.Error(t, err)
+
+	ciphertext, err = EncryptDataRSA(plaintext[:100], publicKey)
+	require.NoError(t, err)
+	result, err = DecryptDataRSA(privateKey, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext[:100], result)
+
+	_, err = DecryptData("not a key", ciphertext)
+	assert.Error(t, err)
+}
+
+func TestSignRequest(t *testing.T) {
+	body := []byte(`[{"id":"Alloc","type":"gauge","value":1.5}]`)
+	sign := SignRequest("secret", "1700000000", "nonce", body)
+
+	assert.Equal(t, sign, SignRequest("secret", "1700000000", "nonce", body))
+	assert.NotEqual(t, sign, SignRequest("secret", "1700000001", "nonce", body))
+	assert.NotEqual(t, sign, SignRequest("secret", "1700000000", "other", body))
+	assert.NotEqual(t, sign, SignRequest("other", "1700000000", "nonce", body))
+
+	first, err := NewNonce()
+	require.NoError(t, err)
+	second, err := NewNonce()
+	require.NoError(t, err)
+	assert.Len(t, first, 32)
+	assert.NotEqual(t, first, second)
+}
+
+func TestNonceCacheValidate(t *testing.T) {
+	assert.NoError(t, NewNonceCache(time.Minute, 1).Validate())
+	assert.Error(t, NewNonceCache(time.Minute, 0).Validate())
+	assert.Error(t, NewNonceCache(-time.Minute, 10).Validate())
+	assert.Error(t, NewNonceCache(0, 10).Validate())
+}
+
+func TestNonceCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cache := NewNonceCache(time.Minute, 3)
+
+	require.NoError(t, cache.Check(NewTimestamp(now), "a", now))
+	assert.Error(t, cache.Check(NewTimestamp(now), "a", now))
+	assert.Error(t, cache.Check(NewTimestamp(now.Add(-2*time.Minute)), "b", now))
+	assert.Error(t, cache.Check(NewTimestamp(now.Add(2*time.Minute)), "b", now))
+	assert.Error(t, cache.Check("yesterday", "b", now))
+	assert.Error(t, cache.Check(NewTimestamp(now), "", now))
+
+	// nonces are not forgotten before they expire, new requests are rejected, when cache is full
+	require.NoError(t, cache.Check(NewTimestamp(now), "b", now))
+	require.NoError(t, cache.Check(NewTimestamp(now), "c", now))
+	assert.ErrorIs(t, cache.Check(NewTimestamp(now), "d", now), ErrNonceCacheFull)
+	assert.Equal(t, 3, cache.Len())
+	assert.Error(t, cache.Check(NewTimestamp(now), "a", now))
+
+	// nonces are forgotten, when their timestamps are outside of clock skew
+	later := now.Add(2 * time.Minute)
+	require.NoError(t, cache.Check(NewTimestamp(later), "e", later))
+	assert.Equal(t, 1, cache.Len())
 }
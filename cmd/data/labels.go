@@ -0,0 +1,103 @@
+package data
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// escapeLabelValue - function, that escapes backslashes, double quotes and line feeds in label name or value.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// sortedLabelNames - function, that returns names of labels in sorted order.
+func sortedLabelNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// escapeMetricName - function, that escapes backslashes and opening braces in metric name,
+// so that the first not escaped brace of series key always starts labels.
+func escapeMetricName(metricName string) string {
+	return strings.NewReplacer(`\`, `\\`, "{", `\{`).Replace(metricName)
+}
+
+// SeriesKey - function, that makes unique key of metric series from metric name and labels sorted by name.
+// Metric name and label names are escaped, so that different series can not make the same key.
+// Key of metric without labels is equal to metric name, if name does not contain backslashes and braces.
+func SeriesKey(metricName string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return escapeMetricName(metricName)
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString(escapeMetricName(metricName))
+	builder.WriteString("{")
+	for i, name := range sortedLabelNames(labels) {
+		if i != 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString(escapeLabelValue(name))
+		builder.WriteString(`="`)
+		builder.WriteString(escapeLabelValue(labels[name]))
+		builder.WriteString(`"`)
+	}
+	builder.WriteString("}")
+
+	return builder.String()
+}
+
+// Key - function, that returns unique key of metric series (metric name and sorted labels).
+func (m Metrics) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// LabelsString - function, that converts labels to canonical string for saving to database.
+// Labels are encoded to JSON with sorted keys, empty labels are converted to empty string.
+func LabelsString(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	labelsBytes, err := json.Marshal(labels)
+	if err != nil {
+		return ""
+	}
+
+	return string(labelsBytes)
+}
+
+// ParseLabelsString - function, that converts canonical string from database back to labels.
+func ParseLabelsString(labelsString string) (map[string]string, error) {
+	if labelsString == "" {
+		return nil, nil
+	}
+
+	labels := make(map[string]string)
+	err := json.Unmarshal([]byte(labelsString), &labels)
+	if err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// CopyLabels - function, that returns copy of labels, nil is returned for empty labels.
+func CopyLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+
+	labelsCopy := make(map[string]string, len(labels))
+	for name, value := range labels {
+		labelsCopy[name] = value
+	}
+
+	return labelsCopy
+}
@@ -0,0 +1,180 @@
+package data
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PrometheusContentType - content type of Prometheus text exposition format 0.0.4.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// SanitizePrometheusName - function, that converts metric name to the form allowed by Prometheus: [a-zA-Z_:][a-zA-Z0-9_:]*.
+func SanitizePrometheusName(name string) string {
+	builder := strings.Builder{}
+	for i, r := range name {
+		switch {
+		case (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_' || r == ':':
+			builder.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				builder.WriteRune('_')
+			}
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune('_')
+		}
+	}
+
+	return builder.String()
+}
+
+// SanitizePrometheusLabelName - function, that converts label name to the form allowed by Prometheus: [a-zA-Z_][a-zA-Z0-9_]*.
+func SanitizePrometheusLabelName(name string) string {
+	return strings.ReplaceAll(SanitizePrometheusName(name), ":", "_")
+}
+
+// formatPrometheusLabels - function, that formats labels sorted by sanitized name as {name="value",...}.
+// If several labels have the same sanitized name, the label with the least original name is used.
+func formatPrometheusLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	sanitized := make(map[string]string, len(labels))
+	for _, name := range sortedLabelNames(labels) {
+		sanitizedName := SanitizePrometheusLabelName(name)
+		if _, ok := sanitized[sanitizedName]; !ok {
+			sanitized[sanitizedName] = labels[name]
+		}
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString("{")
+	for i, name := range sortedLabelNames(sanitized) {
+		if i != 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString(name)
+		builder.WriteString(`="`)
+		builder.WriteString(escapeLabelValue(sanitized[name]))
+		builder.WriteString(`"`)
+	}
+	builder.WriteString("}")
+
+	return builder.String()
+}
+
+// escapePrometheusHelp - function, that escapes backslashes and line feeds in HELP text.
+func escapePrometheusHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// formatPrometheusFloat - function, that formats float value as Prometheus expects it, including special values.
+func formatPrometheusFloat(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// WritePrometheus - function for writing list of metrics in Prometheus text exposition format.
+// Metrics are grouped by sanitized name, every group has one HELP and TYPE line.
+// Different metrics can have the same sanitized name and labels, for example a.b and a-b,
+// then only the series of metric with the least original name and type is written, so that output has no duplicate series.
+func WritePrometheus(w io.Writer, metrics []Metrics) error {
+	type series struct {
+		labels string
+		metric Metrics
+	}
+	type family struct {
+		name   string
+		mType  string
+		series []series
+	}
+
+	sorted := make([]Metrics, 0, len(metrics))
+	for _, metric := range metrics {
+		if metric.ID == "" || (metric.MType == "counter" && metric.Delta == nil) || (metric.MType == "gauge" && metric.Value == nil) {
+			continue
+		}
+		if metric.MType != "counter" && metric.MType != "gauge" {
+			continue
+		}
+		sorted = append(sorted, metric)
+	}
+	// metrics are sorted, so that the same metric wins collision on every scrape
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ID != sorted[j].ID {
+			return sorted[i].ID < sorted[j].ID
+		}
+		if sorted[i].MType != sorted[j].MType {
+			return sorted[i].MType < sorted[j].MType
+		}
+		return sorted[i].Key() < sorted[j].Key()
+	})
+
+	families := make(map[string]*family, len(sorted))
+	written := make(map[string]struct{}, len(sorted))
+	for _, metric := range sorted {
+		name := SanitizePrometheusName(metric.ID)
+		f, ok := families[name]
+		if !ok {
+			f = &family{name: name, mType: metric.MType}
+			families[name] = f
+		}
+		if f.mType != metric.MType {
+			continue
+		}
+
+		labels := formatPrometheusLabels(metric.Labels)
+		if _, ok := written[name+labels]; ok {
+			continue
+		}
+		written[name+labels] = struct{}{}
+		f.series = append(f.series, series{labels: labels, metric: metric})
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := bufio.NewWriter(w)
+	for _, name := range names {
+		f := families[name]
+		help := f.series[0].metric.ID
+		sort.Slice(f.series, func(i, j int) bool {
+			return f.series[i].labels < f.series[j].labels
+		})
+
+		if help != name {
+			buf.WriteString("# HELP " + name + " " + escapePrometheusHelp("Metric "+help) + "\n")
+		}
+		buf.WriteString("# TYPE " + name + " " + f.mType + "\n")
+
+		for _, s := range f.series {
+			buf.WriteString(name)
+			buf.WriteString(s.labels)
+			buf.WriteString(" ")
+			if f.mType == "counter" {
+				buf.WriteString(strconv.FormatInt(*s.metric.Delta, 10))
+			} else {
+				buf.WriteString(formatPrometheusFloat(*s.metric.Value))
+			}
+			buf.WriteString("\n")
+		}
+	}
+
+	return buf.Flush()
+}
@@ -0,0 +1,65 @@
+package data
+
+import (
+	"fmt"
+	"time"
+)
+
+// Aggregation functions, that can be applied to metric history in range query.
+const (
+	AggregationAvg  = "avg"
+	AggregationMin  = "min"
+	AggregationMax  = "max"
+	AggregationSum  = "sum"
+	AggregationLast = "last"
+	AggregationRate = "rate"
+)
+
+// MaxRangeQueryPoints - maximum number of steps in one range query.
+const MaxRangeQueryPoints = 11000
+
+// RangeQuery - type, that describes request for metric history aggregated per step.
+type RangeQuery struct {
+	ID          string            // Metric name
+	MType       string            // Metric Type (counter or gauge)
+	Labels      map[string]string // Metric labels
+	From        time.Time         // Start of the requested range
+	To          time.Time         // End of the requested range
+	Step        time.Duration     // Time duration of one step
+	Aggregation string            // Aggregation function for every step
+}
+
+// Validate - function for checking if range query can be processed.
+func (q RangeQuery) Validate() error {
+	if q.ID == "" {
+		return fmt.Errorf("metric name was not found")
+	}
+
+	if q.MType != "counter" && q.MType != "gauge" {
+		return fmt.Errorf("invalid metric type: %s", q.MType)
+	}
+
+	switch q.Aggregation {
+	case AggregationAvg, AggregationMin, AggregationMax, AggregationSum, AggregationLast:
+	case AggregationRate:
+		if q.MType != "counter" {
+			return fmt.Errorf("aggregation %s can be applied only to counter metrics", q.Aggregation)
+		}
+	default:
+		return fmt.Errorf("invalid aggregation: %s", q.Aggregation)
+	}
+
+	if q.Step <= 0 {
+		return fmt.Errorf("step must be positive")
+	}
+
+	if q.To.Before(q.From) {
+		return fmt.Errorf("end of range must not be before start of range")
+	}
+
+	if q.To.Sub(q.From)/q.Step >= MaxRangeQueryPoints {
+		return fmt.Errorf("exceeded maximum resolution of %d points, increase step", MaxRangeQueryPoints)
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers of signed request, that protect it from replay. Both values are covered by HMAC-SHA256 of request.
+const (
+	TimestampHeader = "X-Timestamp" // Unix time of request in seconds
+	NonceHeader     = "X-Nonce"     // Unique random value of request
+)
+
+// Default settings of replay protection of signed requests.
+const (
+	DefaultMaxClockSkew   = 5 * time.Minute
+	DefaultNonceCacheSize = 100000
+)
+
+// NewNonce - function, that generates random nonce for signed request.
+func NewNonce() (string, error) {
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", fmt.Errorf("error while generating nonce: %w", err)
+	}
+
+	return hex.EncodeToString(nonce), nil
+}
+
+// NewTimestamp - function, that formats time for X-Timestamp header.
+func NewTimestamp(now time.Time) string {
+	return strconv.FormatInt(now.Unix(), 10)
+}
+
+// SignRequest - function, that calculates HMAC-SHA256 of request body, its timestamp and nonce in hex format.
+func SignRequest(secretKey string, timestamp string, nonce string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secretKey))
+	h.Write([]byte(timestamp + "\n" + nonce + "\n"))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ErrNonceCacheFull - error of signed request, which can not be checked, because cache is full of nonces,
+// which are still inside of allowed clock skew. Request must be repeated later.
+var ErrNonceCacheFull = errors.New("cache of nonces is full")
+
+// NonceCache - data type to describe nonces of signed requests, which were received recently.
+// Nonce is remembered, while timestamp of its request is inside of allowed clock skew,
+// after that request is rejected by timestamp. Nonces are never forgotten before that time:
+// if cache is full, new requests are rejected, so that remembered nonces can not be replayed.
+type NonceCache struct {
+	MaxClockSkew time.Duration // Maximum difference between timestamp of request and time of server
+	Size         int           // Maximum number of remembered nonces
+	mutex        sync.Mutex
+	nonces       map[string]time.Time
+	nextExpiry   time.Time
+}
+
+// NewNonceCache - function, that creates cache of nonces.
+func NewNonceCache(maxClockSkew time.Duration, size int) *NonceCache {
+	return &NonceCache{MaxClockSkew: maxClockSkew, Size: size, nonces: make(map[string]time.Time)}
+}
+
+// Validate - function for checking if settings of cache allow to accept signed requests.
+func (c *NonceCache) Validate() error {
+	if c.MaxClockSkew <= 0 {
+		return fmt.Errorf("maximum clock skew must be positive: %s", c.MaxClockSkew)
+	}
+	if c.Size < 1 {
+		return fmt.Errorf("size of nonce cache must be positive: %d", c.Size)
+	}
+
+	return nil
+}
+
+// Check - function, that checks timestamp of request and remembers its nonce.
+// Request is rejected, if its timestamp is outside of allowed clock skew or its nonce was already used.
+// If cache is full of nonces, that are not expired, ErrNonceCacheFull is returned.
+func (c *NonceCache) Check(timestamp string, nonce string, now time.Time) error {
+	if timestamp == "" || nonce == "" {
+		return fmt.Errorf("timestamp and nonce of signed request are required")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp of request: %s", timestamp)
+	}
+	requestTime := time.Unix(seconds, 0)
+	if requestTime.Before(now.Add(-c.MaxClockSkew)) || requestTime.After(now.Add(c.MaxClockSkew)) {
+		return fmt.Errorf("timestamp of request is outside of allowed clock skew %s", c.MaxClockSkew)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.nonces == nil {
+		c.nonces = make(map[string]time.Time)
+	}
+
+	if expires, ok := c.nonces[nonce]; ok && expires.After(now) {
+		return fmt.Errorf("nonce of request was already used")
+	}
+
+	if len(c.nonces) >= c.Size {
+		c.forgetExpired(now)
+		if len(c.nonces) >= c.Size {
+			return ErrNonceCacheFull
+		}
+	}
+
+	expires := requestTime.Add(c.MaxClockSkew)
+	c.nonces[nonce] = expires
+	if c.nextExpiry.IsZero() || expires.Before(c.nextExpiry) {
+		c.nextExpiry = expires
+	}
+
+	return nil
+}
+
+// Len - function, that returns number of remembered nonces.
+func (c *NonceCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.nonces)
+}
+
+// forgetExpired - function for removing nonces, which timestamps are outside of clock skew. Mutex must be locked by caller.
+// Cache is not scanned, until the earliest nonce expires.
+func (c *NonceCache) forgetExpired(now time.Time) {
+	if c.nextExpiry.After(now) {
+		return
+	}
+
+	c.nextExpiry = time.Time{}
+	for nonce, expires := range c.nonces {
+		if !expires.After(now) {
+			delete(c.nonces, nonce)
+			continue
+		}
+		if c.nextExpiry.IsZero() || expires.Before(c.nextExpiry) {
+			c.nextExpiry = expires
+		}
+	}
+}
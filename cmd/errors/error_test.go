@@ -1,11 +1,19 @@
 package retryerr
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestCheckErrorType(t *testing.T) {
@@ -18,3 +26,54 @@ func TestCheckErrorType(t *testing.T) {
 		assert.Equal(t, true, resultErr)
 	})
 }
+
+func TestClassify(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		err  error
+		want Result
+	}{
+		{"nil", nil, Permanent},
+		{"plain error", errors.New("error"), Permanent},
+		{"pgx serialization failure", &pgconn.PgError{Code: pgerrcode.SerializationFailure}, Retryable},
+		{"pgx deadlock", fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: pgerrcode.DeadlockDetected}), Retryable},
+		{"pgx connection failure", &pgconn.PgError{Code: pgerrcode.ConnectionFailure}, Retryable},
+		{"pgx too many connections", &pgconn.PgError{Code: pgerrcode.TooManyConnections}, Throttled},
+		{"pgx unique violation", &pgconn.PgError{Code: pgerrcode.UniqueViolation}, Permanent},
+		{"pq connection exception", &pq.Error{Code: pgerrcode.ConnectionException}, Retryable},
+		{"status 429", NewStatusError(http.StatusTooManyRequests, nil, now), Throttled},
+		{"status 503", NewStatusError(http.StatusServiceUnavailable, nil, now), Retryable},
+		{"status 503 with Retry-After", NewStatusError(http.StatusServiceUnavailable, http.Header{"Retry-After": {"3"}}, now), Throttled},
+		{"status 502", NewStatusError(http.StatusBadGateway, nil, now), Retryable},
+		{"status 504", NewStatusError(http.StatusGatewayTimeout, nil, now), Retryable},
+		{"status 400", NewStatusError(http.StatusBadRequest, nil, now), Permanent},
+		{"status 500", NewStatusError(http.StatusInternalServerError, nil, now), Permanent},
+		{"gRPC unavailable", status.Error(codes.Unavailable, "unavailable"), Retryable},
+		{"gRPC resource exhausted", status.Error(codes.ResourceExhausted, "exhausted"), Throttled},
+		{"gRPC invalid argument", status.Error(codes.InvalidArgument, "invalid"), Permanent},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, Classify(test.err))
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 120*time.Second, ParseRetryAfter("120", now))
+	assert.Equal(t, 30*time.Second, ParseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), ParseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), ParseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), ParseRetryAfter("", now))
+
+	delay, ok := RetryAfter(fmt.Errorf("wrapped: %w", NewStatusError(http.StatusTooManyRequests, http.Header{"Retry-After": {"5"}}, now)))
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, delay)
+
+	_, ok = RetryAfter(errors.New("error"))
+	assert.False(t, ok)
+}
@@ -3,26 +3,166 @@ package retryerr
 
 import (
 	"errors"
+	"fmt"
 	"net"
+	"net/http"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-// CheckErrorType - function, that detects if error is network or not.
-func CheckErrorType(err error) bool {
-	if err, ok := err.(*pq.Error); ok {
-		if (err.Code == pgerrcode.ConnectionException) || (err.Code == pgerrcode.ConnectionDoesNotExist) || (err.Code == pgerrcode.ConnectionFailure) || (err.Code == pgerrcode.InvalidTransactionInitiation) {
-			return true
+// Result - type of classification of error, that describes, if failed operation can be repeated.
+type Result int
+
+// Results of classification of errors.
+const (
+	Permanent Result = iota // Operation must not be repeated
+	Retryable               // Operation can be repeated after delay
+	Throttled               // Operation can be repeated, but remote side asked to slow down
+)
+
+// String - function, that returns name of result.
+func (r Result) String() string {
+	switch r {
+	case Retryable:
+		return "retryable"
+	case Throttled:
+		return "throttled"
+	default:
+		return "permanent"
+	}
+}
+
+// StatusError - error, that describes HTTP response with unsuccessful status code.
+type StatusError struct {
+	StatusCode int           // Status code of response
+	Status     string        // Status of response, such as "503 Service Unavailable"
+	RetryAfter time.Duration // Delay from Retry-After header, 0 if header is not set
+}
+
+// Error - function, that returns text of error.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unsuccessful response status %s", e.Status)
+}
+
+// NewStatusError - function, that makes error from status code and headers of HTTP response.
+func NewStatusError(statusCode int, header http.Header, now time.Time) *StatusError {
+	statusError := &StatusError{StatusCode: statusCode, Status: strconv.Itoa(statusCode) + " " + http.StatusText(statusCode)}
+	if header != nil {
+		statusError.RetryAfter = ParseRetryAfter(header.Get("Retry-After"), now)
+	}
+
+	return statusError
+}
+
+// ParseRetryAfter - function, that parses value of Retry-After header in seconds or as HTTP date.
+// Invalid or past values are parsed as 0.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil || !date.After(now) {
+		return 0
+	}
+
+	return date.Sub(now)
+}
+
+// RetryAfter - function, that returns delay, requested by remote side for repeating operation.
+func RetryAfter(err error) (time.Duration, bool) {
+	var statusError *StatusError
+	if errors.As(err, &statusError) && statusError.RetryAfter > 0 {
+		return statusError.RetryAfter, true
+	}
+
+	return 0, false
+}
+
+// Classify - function, that detects, if operation, failed with error, can be repeated.
+func Classify(err error) Result {
+	if err == nil {
+		return Permanent
+	}
+
+	var statusError *StatusError
+	if errors.As(err, &statusError) {
+		switch statusError.StatusCode {
+		case http.StatusTooManyRequests:
+			return Throttled
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			if statusError.RetryAfter > 0 {
+				return Throttled
+			}
+			return Retryable
 		}
+		return Permanent
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return classifyPostgreSQLCode(pgErr.Code)
 	}
 
-	if net, ok := err.(net.Error); ok {
-		if errors.Is(net, syscall.ECONNREFUSED) || errors.Is(net, syscall.ETIMEDOUT) || errors.Is(net, syscall.EADDRNOTAVAIL) || errors.Is(net, syscall.EHOSTUNREACH) {
-			return true
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return classifyPostgreSQLCode(string(pqErr.Code))
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return Retryable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if errors.Is(netErr, syscall.ECONNREFUSED) || errors.Is(netErr, syscall.ETIMEDOUT) || errors.Is(netErr, syscall.EADDRNOTAVAIL) || errors.Is(netErr, syscall.EHOSTUNREACH) {
+			return Retryable
+		}
+	}
+
+	if grpcErr, ok := status.FromError(err); ok {
+		switch grpcErr.Code() {
+		case codes.Unavailable:
+			return Retryable
+		case codes.ResourceExhausted:
+			return Throttled
 		}
 	}
 
-	return false
+	return Permanent
+}
+
+// classifyPostgreSQLCode - function, that classifies error of PostgreSQL by its code.
+func classifyPostgreSQLCode(code string) Result {
+	switch {
+	case pgerrcode.IsConnectionException(code), code == pgerrcode.InvalidTransactionInitiation:
+		return Retryable
+	case code == pgerrcode.SerializationFailure, code == pgerrcode.DeadlockDetected, code == pgerrcode.CannotConnectNow:
+		return Retryable
+	case code == pgerrcode.TooManyConnections:
+		return Throttled
+	}
+
+	return Permanent
+}
+
+// CheckErrorType - function, that detects if error is temporary, so that operation can be repeated.
+func CheckErrorType(err error) bool {
+	return Classify(err) != Permanent
 }
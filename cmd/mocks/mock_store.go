@@ -7,7 +7,9 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -48,6 +50,20 @@ func (mr *MockRepositoryInterfaceMockRecorder) CheckConnection(arg0 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckConnection", reflect.TypeOf((*MockRepositoryInterface)(nil).CheckConnection), arg0)
 }
 
+// CloseConnections mocks base method.
+func (m *MockRepositoryInterface) CloseConnections() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CloseConnections")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CloseConnections indicates an expected call of CloseConnections.
+func (mr *MockRepositoryInterfaceMockRecorder) CloseConnections() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseConnections", reflect.TypeOf((*MockRepositoryInterface)(nil).CloseConnections))
+}
+
 // GetAllCounterMetrics mocks base method.
 func (m *MockRepositoryInterface) GetAllCounterMetrics() (map[string]int64, error) {
 	m.ctrl.T.Helper()
@@ -78,6 +94,36 @@ func (mr *MockRepositoryInterfaceMockRecorder) GetAllGaugeMetrics() *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllGaugeMetrics", reflect.TypeOf((*MockRepositoryInterface)(nil).GetAllGaugeMetrics))
 }
 
+// GetAllMetrics mocks base method.
+func (m *MockRepositoryInterface) GetAllMetrics() ([]data.Metrics, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAllMetrics")
+	ret0, _ := ret[0].([]data.Metrics)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAllMetrics indicates an expected call of GetAllMetrics.
+func (mr *MockRepositoryInterfaceMockRecorder) GetAllMetrics() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllMetrics", reflect.TypeOf((*MockRepositoryInterface)(nil).GetAllMetrics))
+}
+
+// GetCounterValue mocks base method.
+func (m *MockRepositoryInterface) GetCounterValue(arg0 string, arg1 map[string]string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCounterValue", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCounterValue indicates an expected call of GetCounterValue.
+func (mr *MockRepositoryInterfaceMockRecorder) GetCounterValue(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCounterValue", reflect.TypeOf((*MockRepositoryInterface)(nil).GetCounterValue), arg0, arg1)
+}
+
 // GetCounterValueByName mocks base method.
 func (m *MockRepositoryInterface) GetCounterValueByName(arg0 string) (int64, error) {
 	m.ctrl.T.Helper()
@@ -93,6 +139,21 @@ func (mr *MockRepositoryInterfaceMockRecorder) GetCounterValueByName(arg0 interf
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCounterValueByName", reflect.TypeOf((*MockRepositoryInterface)(nil).GetCounterValueByName), arg0)
 }
 
+// GetGaugeValue mocks base method.
+func (m *MockRepositoryInterface) GetGaugeValue(arg0 string, arg1 map[string]string) (float64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGaugeValue", arg0, arg1)
+	ret0, _ := ret[0].(float64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGaugeValue indicates an expected call of GetGaugeValue.
+func (mr *MockRepositoryInterfaceMockRecorder) GetGaugeValue(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGaugeValue", reflect.TypeOf((*MockRepositoryInterface)(nil).GetGaugeValue), arg0, arg1)
+}
+
 // GetGaugeValueByName mocks base method.
 func (m *MockRepositoryInterface) GetGaugeValueByName(arg0 string) (float64, error) {
 	m.ctrl.T.Helper()
@@ -108,18 +169,62 @@ func (mr *MockRepositoryInterfaceMockRecorder) GetGaugeValueByName(arg0 interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGaugeValueByName", reflect.TypeOf((*MockRepositoryInterface)(nil).GetGaugeValueByName), arg0)
 }
 
+// GetMetricHistory mocks base method.
+func (m *MockRepositoryInterface) GetMetricHistory(arg0, arg1 string, arg2 map[string]string, arg3, arg4 time.Time) ([]data.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMetricHistory", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]data.Sample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMetricHistory indicates an expected call of GetMetricHistory.
+func (mr *MockRepositoryInterfaceMockRecorder) GetMetricHistory(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetricHistory", reflect.TypeOf((*MockRepositoryInterface)(nil).GetMetricHistory), arg0, arg1, arg2, arg3, arg4)
+}
+
+// GetMetricRange mocks base method.
+func (m *MockRepositoryInterface) GetMetricRange(arg0 data.RangeQuery) ([]data.Point, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMetricRange", arg0)
+	ret0, _ := ret[0].([]data.Point)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMetricRange indicates an expected call of GetMetricRange.
+func (mr *MockRepositoryInterfaceMockRecorder) GetMetricRange(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetricRange", reflect.TypeOf((*MockRepositoryInterface)(nil).GetMetricRange), arg0)
+}
+
 // Init mocks base method.
-func (m *MockRepositoryInterface) Init() error {
+func (m *MockRepositoryInterface) Init(arg0 context.Context, arg1 chan struct{}) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Init")
+	ret := m.ctrl.Call(m, "Init", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Init indicates an expected call of Init.
-func (mr *MockRepositoryInterfaceMockRecorder) Init() *gomock.Call {
+func (mr *MockRepositoryInterfaceMockRecorder) Init(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Init", reflect.TypeOf((*MockRepositoryInterface)(nil).Init))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Init", reflect.TypeOf((*MockRepositoryInterface)(nil).Init), arg0, arg1)
+}
+
+// RepositoryAddAllValues mocks base method.
+func (m *MockRepositoryInterface) RepositoryAddAllValues(arg0 []data.Metrics) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RepositoryAddAllValues", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RepositoryAddAllValues indicates an expected call of RepositoryAddAllValues.
+func (mr *MockRepositoryInterfaceMockRecorder) RepositoryAddAllValues(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RepositoryAddAllValues", reflect.TypeOf((*MockRepositoryInterface)(nil).RepositoryAddAllValues), arg0)
 }
 
 // RepositoryAddCounterValue mocks base method.
@@ -163,3 +268,17 @@ func (mr *MockRepositoryInterfaceMockRecorder) RepositoryAddValue(arg0, arg1 int
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RepositoryAddValue", reflect.TypeOf((*MockRepositoryInterface)(nil).RepositoryAddValue), arg0, arg1)
 }
+
+// RepositoryDeleteOldSamples mocks base method.
+func (m *MockRepositoryInterface) RepositoryDeleteOldSamples(arg0 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RepositoryDeleteOldSamples", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RepositoryDeleteOldSamples indicates an expected call of RepositoryDeleteOldSamples.
+func (mr *MockRepositoryInterfaceMockRecorder) RepositoryDeleteOldSamples(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RepositoryDeleteOldSamples", reflect.TypeOf((*MockRepositoryInterface)(nil).RepositoryDeleteOldSamples), arg0)
+}
@@ -0,0 +1,58 @@
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative metrics.proto
+
+package proto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+
+	"google.golang.org/protobuf/proto"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// Keys of gRPC metadata of signed requests.
+const (
+	HashMetadataKey      = "hashsha256"  // HMAC-SHA256 of sent metrics, timestamp and nonce
+	TimestampMetadataKey = "x-timestamp" // Unix time of request in seconds
+	NonceMetadataKey     = "x-nonce"     // Unique random value of request
+)
+
+// FromMetrics - function, that converts list of metrics to gRPC request.
+func FromMetrics(metrics []data.Metrics) *UpdateMetricsRequest {
+	request := &UpdateMetricsRequest{Metrics: make([]*Metric, 0, len(metrics))}
+	for _, metric := range metrics {
+		request.Metrics = append(request.Metrics, &Metric{Id: metric.ID, Type: metric.MType, Delta: metric.Delta, Value: metric.Value, Labels: metric.Labels})
+	}
+
+	return request
+}
+
+// ToMetrics - function, that converts gRPC request to list of metrics.
+func (r *UpdateMetricsRequest) ToMetrics() []data.Metrics {
+	metrics := make([]data.Metrics, 0, len(r.GetMetrics()))
+	for _, metric := range r.GetMetrics() {
+		metrics = append(metrics, data.Metrics{ID: metric.GetId(), MType: metric.GetType(), Delta: metric.Delta, Value: metric.Value, Labels: data.CopyLabels(metric.GetLabels())})
+	}
+
+	return metrics
+}
+
+// Sign - function, that calculates HMAC-SHA256 of timestamp, nonce and requests in hex format.
+// Every request is encoded deterministically and prefixed with its length, so that stream of requests has one sign.
+func Sign(secretKey string, timestamp string, nonce string, requests ...*UpdateMetricsRequest) (string, error) {
+	h := hmac.New(sha256.New, []byte(secretKey))
+	h.Write([]byte(timestamp + "\n" + nonce + "\n"))
+	for _, request := range requests {
+		requestBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(request)
+		if err != nil {
+			return "", err
+		}
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(requestBytes))))
+		h.Write(requestBytes)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
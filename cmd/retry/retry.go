@@ -0,0 +1,242 @@
+// Retry - package for repeating operations, that failed with temporary errors.
+package retry
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+	retryerr "github.com/Tanya1515/metrics-collector.git/cmd/errors"
+)
+
+// Default values of retry policy: 4 attempts with delays 1s, 3s and 5s between them.
+const (
+	DefaultMaxAttempts = 4
+	DefaultBaseDelay   = 1 * time.Second
+	DefaultMaxDelay    = 5 * time.Second
+	DefaultMultiplier  = 3
+)
+
+// Policy - data type to describe, how operation is repeated.
+// Zero policy runs operation only once.
+type Policy struct {
+	MaxAttempts int                                               // Maximum number of attempts, including the first one
+	BaseDelay   time.Duration                                     // Delay before the second attempt
+	MaxDelay    time.Duration                                     // Maximum delay between attempts, 0 - no limit
+	Multiplier  float64                                           // Multiplier of delay after every attempt, values less than 1 keep delay constant
+	Jitter      bool                                              // Flag for full jitter: delay is random value between 0 and computed delay
+	Deadline    time.Duration                                     // Time duration of all attempts with delays, 0 - no limit
+	Classifier  func(err error) retryerr.Result                   // Function, that detects temporary errors, retryerr.Classify by default
+	OnRetry     func(attempt int, err error, delay time.Duration) // Function, that is called before every repeated attempt
+}
+
+// DefaultPolicy - function, that returns policy with default values.
+func DefaultPolicy() Policy {
+	return Policy{MaxAttempts: DefaultMaxAttempts, BaseDelay: DefaultBaseDelay, MaxDelay: DefaultMaxDelay, Multiplier: DefaultMultiplier}
+}
+
+// WithClassifier - function, that returns copy of policy with custom classifier of errors.
+func (p Policy) WithClassifier(classifier func(err error) retryerr.Result) Policy {
+	p.Classifier = classifier
+	return p
+}
+
+// WithOnRetry - function, that returns copy of policy with function, called before every repeated attempt.
+func (p Policy) WithOnRetry(onRetry func(attempt int, err error, delay time.Duration)) Policy {
+	p.OnRetry = onRetry
+	return p
+}
+
+// Delay - function, that returns delay after failed attempt with number attempt, starting from 1, without jitter.
+func (p Policy) Delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.BaseDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	if delay > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(delay)
+}
+
+// Validate - function, that checks values of policy.
+func (p Policy) Validate() error {
+	if p.MaxAttempts < 1 {
+		return fmt.Errorf("maximum number of attempts must be positive: %d", p.MaxAttempts)
+	}
+	if p.BaseDelay < 0 || p.MaxDelay < 0 || p.Deadline < 0 {
+		return fmt.Errorf("delays and deadline of retry policy must not be negative")
+	}
+	if p.Multiplier < 0 {
+		return fmt.Errorf("multiplier of retry policy must not be negative: %v", p.Multiplier)
+	}
+
+	return nil
+}
+
+// Do - function for running operation until it succeeds, fails with permanent error or attempts are over.
+// After throttled error the next attempt is delayed at least for time, requested by remote side in Retry-After.
+// Waiting between attempts stops, when context is canceled or the next attempt would start after deadline of policy.
+// The function returns error of the last attempt, joined with error of context, if context was canceled.
+func Do(ctx context.Context, policy Policy, operation func() error) error {
+	classifier := policy.Classifier
+	if classifier == nil {
+		classifier = retryerr.Classify
+	}
+
+	var deadline time.Time
+	if policy.Deadline > 0 {
+		deadline = time.Now().Add(policy.Deadline)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := operation()
+		if err == nil {
+			return nil
+		}
+		result := classifier(err)
+		if attempt >= policy.MaxAttempts || result == retryerr.Permanent {
+			return err
+		}
+
+		delay := policy.Delay(attempt)
+		if policy.Jitter && delay > 0 {
+			delay = rand.N(delay + 1)
+		}
+		if retryAfter, ok := retryerr.RetryAfter(err); ok && result == retryerr.Throttled && retryAfter > delay {
+			delay = retryAfter
+		}
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			return err
+		}
+
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// jitterFlagName - name of command line flag for jitter of retry policy.
+const jitterFlagName = "retry-jitter"
+
+// Flags - data type to describe command line flags of retry policy.
+type Flags struct {
+	MaxAttempts *int
+	BaseDelay   *time.Duration
+	MaxDelay    *time.Duration
+	Multiplier  *float64
+	Jitter      *bool
+	Deadline    *time.Duration
+}
+
+// NewFlags - function, that defines command line flags of retry policy.
+func NewFlags() *Flags {
+	return &Flags{
+		MaxAttempts: flag.Int("retry-max-attempts", DefaultMaxAttempts, "maximum number of attempts of request, including the first one"),
+		BaseDelay:   flag.Duration("retry-base-delay", DefaultBaseDelay, "delay before the second attempt of request"),
+		MaxDelay:    flag.Duration("retry-max-delay", DefaultMaxDelay, "maximum delay between attempts of request, 0 - no limit"),
+		Multiplier:  flag.Float64("retry-multiplier", DefaultMultiplier, "multiplier of delay after every attempt of request"),
+		Jitter:      flag.Bool(jitterFlagName, false, "use random delay between 0 and computed delay"),
+		Deadline:    flag.Duration("retry-deadline", 0, "time duration of all attempts of request, 0 - no limit"),
+	}
+}
+
+// Policy - function, that makes retry policy from environment variables, command line flags and config file.
+// Value from config file is used, if neither environment variable nor flag changed default value.
+func (f *Flags) Policy(config data.RetryConfig, configFilePath string) (Policy, error) {
+	var err error
+	policy := Policy{
+		MaxAttempts: *f.MaxAttempts,
+		BaseDelay:   *f.BaseDelay,
+		MaxDelay:    *f.MaxDelay,
+		Multiplier:  *f.Multiplier,
+		Jitter:      *f.Jitter,
+		Deadline:    *f.Deadline,
+	}
+
+	if value, envExists := os.LookupEnv("RETRY_MAX_ATTEMPTS"); envExists {
+		policy.MaxAttempts, err = strconv.Atoi(value)
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid RETRY_MAX_ATTEMPTS: %w", err)
+		}
+	}
+	if policy.MaxAttempts == DefaultMaxAttempts && configFilePath != "" && config.MaxAttempts != 0 {
+		policy.MaxAttempts = config.MaxAttempts
+	}
+
+	durations := []struct {
+		env          string
+		value        *time.Duration
+		defaultValue time.Duration
+		config       string
+	}{
+		{"RETRY_BASE_DELAY", &policy.BaseDelay, DefaultBaseDelay, config.BaseDelay},
+		{"RETRY_MAX_DELAY", &policy.MaxDelay, DefaultMaxDelay, config.MaxDelay},
+		{"RETRY_DEADLINE", &policy.Deadline, 0, config.Deadline},
+	}
+	for _, duration := range durations {
+		if value, envExists := os.LookupEnv(duration.env); envExists {
+			*duration.value, err = time.ParseDuration(value)
+			if err != nil {
+				return Policy{}, fmt.Errorf("invalid %s: %w", duration.env, err)
+			}
+		}
+		if *duration.value == duration.defaultValue && configFilePath != "" && duration.config != "" {
+			*duration.value, err = time.ParseDuration(duration.config)
+			if err != nil {
+				return Policy{}, fmt.Errorf("invalid duration in retry config: %w", err)
+			}
+		}
+	}
+
+	if value, envExists := os.LookupEnv("RETRY_MULTIPLIER"); envExists {
+		policy.Multiplier, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid RETRY_MULTIPLIER: %w", err)
+		}
+	}
+	if policy.Multiplier == DefaultMultiplier && configFilePath != "" && config.Multiplier != 0 {
+		policy.Multiplier = config.Multiplier
+	}
+
+	// default value of jitter can not be told from explicitly disabled jitter, so flag is checked for being set
+	jitterSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == jitterFlagName {
+			jitterSet = true
+		}
+	})
+	if value, envExists := os.LookupEnv("RETRY_JITTER"); envExists {
+		policy.Jitter, err = strconv.ParseBool(value)
+		if err != nil {
+			return Policy{}, fmt.Errorf("invalid RETRY_JITTER: %w", err)
+		}
+		jitterSet = true
+	}
+	if !jitterSet && configFilePath != "" {
+		policy.Jitter = config.Jitter
+	}
+
+	return policy, policy.Validate()
+}
@@ -0,0 +1,184 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+	retryerr "github.com/Tanya1515/metrics-collector.git/cmd/errors"
+)
+
+var errTemporary = errors.New("temporary error")
+
+func isTemporary(err error) retryerr.Result {
+	if errors.Is(err, errTemporary) {
+		return retryerr.Retryable
+	}
+	return retryerr.Permanent
+}
+
+func TestPolicyDelay(t *testing.T) {
+	policy := DefaultPolicy()
+	assert.Equal(t, 1*time.Second, policy.Delay(1))
+	assert.Equal(t, 3*time.Second, policy.Delay(2))
+	assert.Equal(t, 5*time.Second, policy.Delay(3))
+	assert.Equal(t, 5*time.Second, policy.Delay(10))
+
+	policy = Policy{BaseDelay: time.Second, Multiplier: 0.5}
+	assert.Equal(t, time.Second, policy.Delay(3))
+}
+
+func TestDo(t *testing.T) {
+	policy := Policy{MaxAttempts: 4, BaseDelay: time.Millisecond, Multiplier: 2, Classifier: isTemporary}
+
+	t.Run("Test success after retries:", func(t *testing.T) {
+		attempts := 0
+		var delays []time.Duration
+		err := Do(context.Background(), policy.WithOnRetry(func(attempt int, err error, delay time.Duration) {
+			delays = append(delays, delay)
+		}), func() error {
+			attempts++
+			if attempts < 3 {
+				return errTemporary
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, []time.Duration{time.Millisecond, 2 * time.Millisecond}, delays)
+	})
+
+	t.Run("Test attempts are over:", func(t *testing.T) {
+		attempts := 0
+		err := Do(context.Background(), policy, func() error {
+			attempts++
+			return errTemporary
+		})
+		assert.ErrorIs(t, err, errTemporary)
+		assert.Equal(t, 4, attempts)
+	})
+
+	t.Run("Test permanent error:", func(t *testing.T) {
+		attempts := 0
+		permanent := errors.New("permanent error")
+		err := Do(context.Background(), policy, func() error {
+			attempts++
+			return permanent
+		})
+		assert.ErrorIs(t, err, permanent)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("Test zero policy:", func(t *testing.T) {
+		attempts := 0
+		err := Do(context.Background(), Policy{Classifier: isTemporary}, func() error {
+			attempts++
+			return errTemporary
+		})
+		assert.ErrorIs(t, err, errTemporary)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("Test canceled context:", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		attempts := 0
+		err := Do(ctx, Policy{MaxAttempts: 4, BaseDelay: time.Hour, Classifier: isTemporary}, func() error {
+			attempts++
+			cancel()
+			return errTemporary
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.ErrorIs(t, err, errTemporary)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("Test deadline:", func(t *testing.T) {
+		attempts := 0
+		err := Do(context.Background(), Policy{MaxAttempts: 10, BaseDelay: 20 * time.Millisecond, Deadline: 50 * time.Millisecond, Classifier: isTemporary}, func() error {
+			attempts++
+			return errTemporary
+		})
+		assert.ErrorIs(t, err, errTemporary)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("Test Retry-After:", func(t *testing.T) {
+		var delays []time.Duration
+		attempts := 0
+		err := Do(context.Background(), Policy{MaxAttempts: 2, BaseDelay: time.Millisecond,
+			OnRetry: func(attempt int, err error, delay time.Duration) {
+				delays = append(delays, delay)
+			}}, func() error {
+			attempts++
+			if attempts == 1 {
+				return &retryerr.StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: 20 * time.Millisecond}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []time.Duration{20 * time.Millisecond}, delays)
+	})
+
+	t.Run("Test jitter:", func(t *testing.T) {
+		var delays []time.Duration
+		Do(context.Background(), Policy{MaxAttempts: 20, BaseDelay: time.Millisecond, Multiplier: 1, Jitter: true, Classifier: isTemporary,
+			OnRetry: func(attempt int, err error, delay time.Duration) {
+				delays = append(delays, delay)
+			}}, func() error {
+			return errTemporary
+		})
+		require.Len(t, delays, 19)
+		for _, delay := range delays {
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.LessOrEqual(t, delay, time.Millisecond)
+		}
+	})
+}
+
+func TestFlagsPolicy(t *testing.T) {
+	flags := NewFlags()
+
+	policy, err := flags.Policy(data.RetryConfig{MaxAttempts: 7}, "")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultPolicy(), policy)
+
+	config := data.RetryConfig{MaxAttempts: 7, BaseDelay: "2s", MaxDelay: "1m", Multiplier: 2, Jitter: true, Deadline: "30s"}
+	policy, err = flags.Policy(config, "config.json")
+	require.NoError(t, err)
+	assert.Equal(t, Policy{MaxAttempts: 7, BaseDelay: 2 * time.Second, MaxDelay: time.Minute, Multiplier: 2, Jitter: true, Deadline: 30 * time.Second}, policy)
+
+	t.Setenv("RETRY_MAX_ATTEMPTS", "2")
+	t.Setenv("RETRY_BASE_DELAY", "100ms")
+	policy, err = flags.Policy(config, "config.json")
+	require.NoError(t, err)
+	assert.Equal(t, 2, policy.MaxAttempts)
+	assert.Equal(t, 100*time.Millisecond, policy.BaseDelay)
+
+	// explicitly disabled jitter is not overridden by config file
+	t.Setenv("RETRY_JITTER", "false")
+	policy, err = flags.Policy(config, "config.json")
+	require.NoError(t, err)
+	assert.False(t, policy.Jitter)
+
+	require.NoError(t, os.Unsetenv("RETRY_JITTER"))
+	require.NoError(t, flag.Set(jitterFlagName, "false"))
+	policy, err = flags.Policy(config, "config.json")
+	require.NoError(t, err)
+	assert.False(t, policy.Jitter)
+
+	t.Setenv("RETRY_MAX_ATTEMPTS", "0")
+	_, err = flags.Policy(data.RetryConfig{}, "")
+	assert.Error(t, err)
+
+	t.Setenv("RETRY_MAX_ATTEMPTS", "two")
+	_, err = flags.Policy(data.RetryConfig{}, "")
+	assert.Error(t, err)
+}
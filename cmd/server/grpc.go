@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+	pb "github.com/Tanya1515/metrics-collector.git/cmd/proto"
+	retry "github.com/Tanya1515/metrics-collector.git/cmd/retry"
+)
+
+// Limits of signed stream of metrics. Sign covers the whole stream, so pools of signed stream are kept in memory,
+// until the last pool is received.
+const (
+	MaxSignedStreamMessages = 1000     // Maximum number of pools in signed stream
+	MaxSignedStreamBytes    = 16 << 20 // Maximum size of all pools in signed stream in bytes
+)
+
+// MetricsServer - data type to describe gRPC service for gathering metrics from agents.
+type MetricsServer struct {
+	pb.UnimplementedMetricsServiceServer
+	App *Application
+}
+
+// NewGRPCServer - function, that makes gRPC server with registered metrics service.
+func (App *Application) NewGRPCServer() *grpc.Server {
+	server := grpc.NewServer()
+	pb.RegisterMetricsServiceServer(server, &MetricsServer{App: App})
+
+	return server
+}
+
+// isSigned - function, that reports, whether request has sign, which must be checked.
+func (s *MetricsServer) isSigned(ctx context.Context) bool {
+	if s.App.SecretKey == "" {
+		return false
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	return len(md.Get(pb.HashMetadataKey)) != 0
+}
+
+// checkSign - function for checking HMAC-SHA256 of requests, timestamp and nonce, that are sent in gRPC metadata.
+// Requests without sign are accepted as in http-handlers.
+func (s *MetricsServer) checkSign(ctx context.Context, requests ...*pb.UpdateMetricsRequest) error {
+	if s.App.SecretKey == "" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	signs := md.Get(pb.HashMetadataKey)
+	if len(signs) == 0 {
+		return nil
+	}
+
+	timestamps := md.Get(pb.TimestampMetadataKey)
+	nonces := md.Get(pb.NonceMetadataKey)
+	if len(timestamps) == 0 || len(nonces) == 0 {
+		s.App.Logger.Errorln("Signed request without timestamp or nonce")
+		return status.Errorf(codes.Unauthenticated, "signed request must contain %s and %s metadata", pb.TimestampMetadataKey, pb.NonceMetadataKey)
+	}
+
+	signCheck, err := pb.Sign(s.App.SecretKey, timestamps[0], nonces[0], requests...)
+	if err != nil {
+		return status.Errorf(codes.Internal, "error while calculating HashSHA256: %s", err)
+	}
+
+	if !(hmac.Equal([]byte(signs[0]), []byte(signCheck))) {
+		s.App.Logger.Errorln("HashSHA256 is incorrect")
+		return status.Error(codes.Unauthenticated, "error while checking HashSHA256 of the request")
+	}
+
+	err = s.App.Nonces.Check(timestamps[0], nonces[0], time.Now())
+	if errors.Is(err, data.ErrNonceCacheFull) {
+		s.App.Logger.Errorln("Replay protection can not check the request:", err)
+		return status.Errorf(codes.Unavailable, "%s", err)
+	}
+	if err != nil {
+		s.App.Logger.Errorln("Replay protection rejected the request:", err)
+		return status.Errorf(codes.Unauthenticated, "%s", err)
+	}
+
+	return nil
+}
+
+// saveMetrics - function for checking and saving metrics to storage.
+func (s *MetricsServer) saveMetrics(ctx context.Context, metrics []data.Metrics) error {
+	for _, metric := range metrics {
+		if metric.ID == "" {
+			s.App.Logger.Errorln("Metric name was not found")
+			return status.Error(codes.NotFound, "metric name was not found")
+		}
+		if (metric.MType != "counter") && (metric.MType != "gauge") {
+			s.App.Logger.Errorln(fmt.Sprintf("Metric with name %s invalid metric type : %s", metric.ID, metric.MType))
+			return status.Errorf(codes.InvalidArgument, "metric with name %s invalid metric type : %s", metric.ID, metric.MType)
+		}
+		if (metric.MType == "counter" && metric.Delta == nil) || (metric.MType == "gauge" && metric.Value == nil) {
+			s.App.Logger.Errorln("Metric without value:", metric.ID)
+			return status.Errorf(codes.InvalidArgument, "metric with name %s does not have value", metric.ID)
+		}
+	}
+
+	err := retry.Do(ctx, s.App.RetryPolicy, func() error {
+		return s.App.Storage.RepositoryAddAllValues(metrics)
+	})
+	if err != nil {
+		s.App.Logger.Errorln("Error while adding all metrics to storage", err)
+		return status.Errorf(codes.Internal, "error while adding all metrics to storage: %s", err)
+	}
+
+	return nil
+}
+
+// UpdateMetrics - function, that saves one pool of metrics.
+func (s *MetricsServer) UpdateMetrics(ctx context.Context, request *pb.UpdateMetricsRequest) (*pb.UpdateMetricsResponse, error) {
+	err := s.checkSign(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := request.ToMetrics()
+	err = s.saveMetrics(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdateMetricsResponse{Count: int64(len(metrics))}, nil
+}
+
+// StreamMetrics - function, that saves all pools of metrics from stream.
+// Pools of unsigned stream are saved as they arrive. Sign covers the whole stream, so pools of signed stream
+// are saved only after the last pool is received, and stream is rejected, if it exceeds limits of signed stream.
+func (s *MetricsServer) StreamMetrics(stream grpc.ClientStreamingServer[pb.UpdateMetricsRequest, pb.UpdateMetricsResponse]) error {
+	ctx := stream.Context()
+	signed := s.isSigned(ctx)
+	requests := make([]*pb.UpdateMetricsRequest, 0)
+	var size int
+	var count int64
+	for {
+		request, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if !signed {
+			metrics := request.ToMetrics()
+			err = s.saveMetrics(ctx, metrics)
+			if err != nil {
+				return err
+			}
+			count += int64(len(metrics))
+			continue
+		}
+
+		size += proto.Size(request)
+		if len(requests) >= MaxSignedStreamMessages || size > MaxSignedStreamBytes {
+			s.App.Logger.Errorln("Signed stream exceeded limits")
+			return status.Errorf(codes.ResourceExhausted, "signed stream exceeded limit of %d pools or %d bytes", MaxSignedStreamMessages, MaxSignedStreamBytes)
+		}
+		requests = append(requests, request)
+	}
+
+	if signed {
+		err := s.checkSign(ctx, requests...)
+		if err != nil {
+			return err
+		}
+
+		metrics := make([]data.Metrics, 0)
+		for _, request := range requests {
+			metrics = append(metrics, request.ToMetrics()...)
+		}
+
+		err = s.saveMetrics(ctx, metrics)
+		if err != nil {
+			return err
+		}
+		count = int64(len(metrics))
+	}
+
+	return stream.SendAndClose(&pb.UpdateMetricsResponse{Count: count})
+}
@@ -16,8 +16,9 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	alerting "github.com/Tanya1515/metrics-collector.git/cmd/alerting"
 	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
-	retryerr "github.com/Tanya1515/metrics-collector.git/cmd/errors"
+	retry "github.com/Tanya1515/metrics-collector.git/cmd/retry"
 )
 
 // UpdateValuePath - handler, that updates metric in PostgreSQL or in-memory storage.
@@ -51,21 +52,13 @@ func (App *Application) UpdateValuePath() http.HandlerFunc {
 				return
 			}
 
-			for i := 0; i <= 3; i++ {
-				err = App.Storage.RepositoryAddCounterValue(metricName, metricValueInt64)
-				if err == nil {
-					break
-				}
-				if !(retryerr.CheckErrorType(err)) || (i == 3) {
-					http.Error(rw, fmt.Sprintf("Error 500: Error while adding counter metric %s to Storage", metricData.ID), http.StatusInternalServerError)
-					App.Logger.Errorln("Error while adding counter metric to Storage:", err)
-					return
-				}
-				if i == 0 {
-					time.Sleep(1 * time.Second)
-				} else {
-					time.Sleep(time.Duration(i+i+1) * time.Second)
-				}
+			err = retry.Do(r.Context(), App.RetryPolicy, func() error {
+				return App.Storage.RepositoryAddCounterValue(metricName, metricValueInt64)
+			})
+			if err != nil {
+				http.Error(rw, fmt.Sprintf("Error 500: Error while adding counter metric %s to Storage", metricData.ID), http.StatusInternalServerError)
+				App.Logger.Errorln("Error while adding counter metric to Storage:", err)
+				return
 			}
 		}
 		if metricType == "gauge" {
@@ -76,21 +69,13 @@ func (App *Application) UpdateValuePath() http.HandlerFunc {
 				App.Logger.Errorln("Invalid metric value:", err)
 				return
 			}
-			for i := 0; i <= 3; i++ {
-				err = App.Storage.RepositoryAddGaugeValue(metricName, metricValueFloat64)
-				if err == nil {
-					break
-				}
-				if !(retryerr.CheckErrorType(err)) || (i == 3) {
-					http.Error(rw, fmt.Sprintf("Error 500: Error while adding gauge metric %s to Storage", metricName), http.StatusInternalServerError)
-					App.Logger.Errorln("Error while adding gauge metric to Storage:", err)
-					return
-				}
-				if i == 0 {
-					time.Sleep(1 * time.Second)
-				} else {
-					time.Sleep(time.Duration(i+i+1) * time.Second)
-				}
+			err = retry.Do(r.Context(), App.RetryPolicy, func() error {
+				return App.Storage.RepositoryAddGaugeValue(metricName, metricValueFloat64)
+			})
+			if err != nil {
+				http.Error(rw, fmt.Sprintf("Error 500: Error while adding gauge metric %s to Storage", metricName), http.StatusInternalServerError)
+				App.Logger.Errorln("Error while adding gauge metric to Storage:", err)
+				return
 			}
 		}
 
@@ -137,40 +122,20 @@ func (App *Application) UpdateValue() http.HandlerFunc {
 			return
 		}
 
-		if metricData.MType == "counter" {
-			for i := 0; i <= 3; i++ {
-				err := App.Storage.RepositoryAddCounterValue(metricData.ID, *metricData.Delta)
-				if err == nil {
-					break
-				}
-				if !(retryerr.CheckErrorType(err)) || (i == 3) {
-					http.Error(rw, fmt.Sprintf("Error 500: Error while adding counter metric %s to Storage", metricData.ID), http.StatusInternalServerError)
-					App.Logger.Errorln("Error while adding counter metric to Storage:", err)
-					return
-				}
-				if i == 0 {
-					time.Sleep(1 * time.Second)
-				} else {
-					time.Sleep(time.Duration(i+i+1) * time.Second)
-				}
-			}
+		if (metricData.MType == "counter" && metricData.Delta == nil) || (metricData.MType == "gauge" && metricData.Value == nil) {
+			http.Error(rw, fmt.Sprintf("Error 400: Metric with name %s does not have value", metricData.ID), http.StatusBadRequest)
+			App.Logger.Errorln("Metric without value:", metricData.ID)
+			return
 		}
-		if metricData.MType == "gauge" {
-			for i := 0; i <= 3; i++ {
-				err := App.Storage.RepositoryAddGaugeValue(metricData.ID, *metricData.Value)
-				if err == nil {
-					break
-				} else if !(retryerr.CheckErrorType(err)) || (i == 3) {
-					http.Error(rw, fmt.Sprintf("Error 500: Error while adding gauge metric %s to Storage", metricData.ID), http.StatusInternalServerError)
-					App.Logger.Errorln("Error while adding gauge metric to Storage:", err)
-					return
-				}
-				if i == 0 {
-					time.Sleep(1 * time.Second)
-				} else {
-					time.Sleep(time.Duration(i+i+1) * time.Second)
-				}
-			}
+
+		// metric is saved as a pool of one element, so that metric labels are kept in the storage
+		err = retry.Do(r.Context(), App.RetryPolicy, func() error {
+			return App.Storage.RepositoryAddAllValues([]data.Metrics{metricData})
+		})
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("Error 500: Error while adding %s metric %s to Storage", metricData.MType, metricData.ID), http.StatusInternalServerError)
+			App.Logger.Errorln("Error while adding metric to Storage:", err)
+			return
 		}
 
 		metricDataBytes, err := json.Marshal(metricData)
@@ -201,21 +166,14 @@ func (App *Application) HTMLMetrics() http.HandlerFunc {
 		builder := strings.Builder{}
 		var allGaugeMetrics map[string]float64
 		var err error
-		for i := 0; i <= 3; i++ {
+		err = retry.Do(r.Context(), App.RetryPolicy, func() error {
 			allGaugeMetrics, err = App.Storage.GetAllGaugeMetrics()
-			if err == nil {
-				break
-			}
-			if !(retryerr.CheckErrorType(err)) || (i == 3) {
-				http.Error(rw, "Error 500: Error while getting all gauge metrics", http.StatusInternalServerError)
-				App.Logger.Errorln(err)
-				return
-			}
-			if i == 0 {
-				time.Sleep(1 * time.Second)
-			} else {
-				time.Sleep(time.Duration(i+i+1) * time.Second)
-			}
+			return err
+		})
+		if err != nil {
+			http.Error(rw, "Error 500: Error while getting all gauge metrics", http.StatusInternalServerError)
+			App.Logger.Errorln(err)
+			return
 		}
 		for key, value := range allGaugeMetrics {
 			builder.WriteString(key)
@@ -227,21 +185,14 @@ func (App *Application) HTMLMetrics() http.HandlerFunc {
 
 		builder = strings.Builder{}
 		var allCounterMetrics map[string]int64
-		for i := 0; i <= 3; i++ {
+		err = retry.Do(r.Context(), App.RetryPolicy, func() error {
 			allCounterMetrics, err = App.Storage.GetAllCounterMetrics()
-			if err == nil {
-				break
-			} else if !(retryerr.CheckErrorType(err)) {
-				http.Error(rw, "Error 500: Error while getting all counter metrics", http.StatusInternalServerError)
-				App.Logger.Errorln(err)
-				return
-			} else if retryerr.CheckErrorType(err) {
-				if i == 0 {
-					time.Sleep(1 * time.Second)
-				} else {
-					time.Sleep(time.Duration(i+i+1) * time.Second)
-				}
-			}
+			return err
+		})
+		if err != nil {
+			http.Error(rw, "Error 500: Error while getting all counter metrics", http.StatusInternalServerError)
+			App.Logger.Errorln(err)
+			return
 		}
 
 		for key, value := range allCounterMetrics {
@@ -271,6 +222,37 @@ Gauge metrics:
 	return http.HandlerFunc(htmlMetricsfunc)
 }
 
+// PrometheusMetrics - handler, that processes metrics from PostgreSQL or in-memory storage and display them in Prometheus text format.
+func (App *Application) PrometheusMetrics() http.HandlerFunc {
+	prometheusMetricsfunc := func(rw http.ResponseWriter, r *http.Request) {
+		var metrics []data.Metrics
+		var err error
+		err = retry.Do(r.Context(), App.RetryPolicy, func() error {
+			metrics, err = App.Storage.GetAllMetrics()
+			return err
+		})
+		if err != nil {
+			http.Error(rw, "Error 500: Error while getting all metrics", http.StatusInternalServerError)
+			App.Logger.Errorln(err)
+			return
+		}
+
+		var buf bytes.Buffer
+		err = data.WritePrometheus(&buf, metrics)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			App.Logger.Errorln("Error while writing metrics in Prometheus format:", err)
+			return
+		}
+
+		rw.Header().Set("Content-Type", data.PrometheusContentType)
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(buf.Bytes())
+	}
+
+	return http.HandlerFunc(prometheusMetricsfunc)
+}
+
 // GetMetricPath - handler, that retrieve metrics value from PostgreSQL or in-memory storage and return the value.
 // The function gets all metric type and name from URL-path.
 func (App *Application) GetMetricPath() http.HandlerFunc {
@@ -287,22 +269,14 @@ func (App *Application) GetMetricPath() http.HandlerFunc {
 		var err error
 		if metricType == "counter" {
 			var metricValue int64
-			for i := 0; i <= 3; i++ {
+			err = retry.Do(r.Context(), App.RetryPolicy, func() error {
 				metricValue, err = App.Storage.GetCounterValueByName(metricName)
-				if err == nil {
-					break
-				} else if !(retryerr.CheckErrorType(err)) {
-					http.Error(rw, fmt.Sprintf("Error 404: %s", err), http.StatusNotFound)
-					App.Logger.Errorln("Error in CounterStorage: ", err)
-					return
-				} else if retryerr.CheckErrorType(err) {
-					if i == 0 {
-						time.Sleep(1 * time.Second)
-					} else {
-						time.Sleep(time.Duration(i+i+1) * time.Second)
-					}
-				}
-
+				return err
+			})
+			if err != nil {
+				http.Error(rw, fmt.Sprintf("Error 404: %s", err), http.StatusNotFound)
+				App.Logger.Errorln("Error in CounterStorage: ", err)
+				return
 			}
 
 			builder := strings.Builder{}
@@ -310,22 +284,14 @@ func (App *Application) GetMetricPath() http.HandlerFunc {
 			metricRes = builder.String()
 		} else if metricType == "gauge" {
 			var metricValue float64
-			for i := 0; i <= 3; i++ {
+			err = retry.Do(r.Context(), App.RetryPolicy, func() error {
 				metricValue, err = App.Storage.GetGaugeValueByName(metricName)
-				if err == nil {
-					break
-				}
-				if !(retryerr.CheckErrorType(err)) {
-					http.Error(rw, fmt.Sprintf("Error 404: %s", err), http.StatusNotFound)
-					App.Logger.Errorln("Error in GaugeStorage: ", err)
-					return
-				}
-
-				if i == 0 {
-					time.Sleep(1 * time.Second)
-				} else {
-					time.Sleep(time.Duration(i+i+1) * time.Second)
-				}
+				return err
+			})
+			if err != nil {
+				http.Error(rw, fmt.Sprintf("Error 404: %s", err), http.StatusNotFound)
+				App.Logger.Errorln("Error in GaugeStorage: ", err)
+				return
 			}
 			metricRes = strconv.FormatFloat(metricValue, 'f', -1, 64)
 		} else {
@@ -372,6 +338,36 @@ func (App *Application) CheckStorageConnection() http.HandlerFunc {
 	return http.HandlerFunc(checkStorageConnectionfunc)
 }
 
+// AlertsList - handler, that returns current state of alerting rules in JSON format.
+// If alerting rules are not configured, the function returns empty list.
+func (App *Application) AlertsList() http.HandlerFunc {
+	alertsListfunc := func(rw http.ResponseWriter, r *http.Request) {
+		alerts := []alerting.Alert{}
+		if App.Alerts != nil {
+			alerts = App.Alerts.Alerts()
+		}
+
+		alertsBytes, err := json.Marshal(alerts)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			App.Logger.Errorln("Error during serialization")
+			return
+		}
+
+		if App.SecretKey != "" {
+			h := hmac.New(sha256.New, []byte(App.SecretKey))
+			h.Write(alertsBytes)
+			signCheck := h.Sum(nil)
+			rw.Header().Set("HashSHA256", hex.EncodeToString(signCheck))
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(alertsBytes)
+	}
+
+	return http.HandlerFunc(alertsListfunc)
+}
+
 // GetMetric - handler, that retrieve metrics value from PostgreSQL or in-memory storage and return the value.
 // The function gets all data about metrics from request body.
 func (App *Application) GetMetric() http.HandlerFunc {
@@ -399,43 +395,34 @@ func (App *Application) GetMetric() http.HandlerFunc {
 		}
 		if metricData.MType == "counter" {
 			var metricValue int64
-			for i := 0; i <= 3; i++ {
-				metricValue, err = App.Storage.GetCounterValueByName(metricData.ID)
-				if err == nil {
-					break
-				}
-
-				if !(retryerr.CheckErrorType(err)) || (i == 3) {
-					http.Error(rw, fmt.Sprintf("Error 404: %s", err), http.StatusNotFound)
-					App.Logger.Errorln("Error in CounterStorage:", err)
-					return
-				}
-
-				if i == 0 {
-					time.Sleep(1 * time.Second)
-				} else {
-					time.Sleep(time.Duration(i+i+1) * time.Second)
+			err = retry.Do(r.Context(), App.RetryPolicy, func() error {
+				if len(metricData.Labels) == 0 {
+					metricValue, err = App.Storage.GetCounterValueByName(metricData.ID)
+					return err
 				}
+				metricValue, err = App.Storage.GetCounterValue(metricData.ID, metricData.Labels)
+				return err
+			})
+			if err != nil {
+				http.Error(rw, fmt.Sprintf("Error 404: %s", err), http.StatusNotFound)
+				App.Logger.Errorln("Error in CounterStorage:", err)
+				return
 			}
 			metricData.Delta = &metricValue
 		} else if metricData.MType == "gauge" {
 			var metricValue float64
-			for i := 0; i <= 3; i++ {
-				metricValue, err = App.Storage.GetGaugeValueByName(metricData.ID)
-				if err == nil {
-					break
-				}
-				if !(retryerr.CheckErrorType(err)) || (i == 3) {
-					http.Error(rw, fmt.Sprintf("Error 404: %s", err), http.StatusNotFound)
-					App.Logger.Errorln("Error in GaugeStorage:", err)
-					return
-				}
-
-				if i == 0 {
-					time.Sleep(1 * time.Second)
-				} else {
-					time.Sleep(time.Duration(i+i+1) * time.Second)
+			err = retry.Do(r.Context(), App.RetryPolicy, func() error {
+				if len(metricData.Labels) == 0 {
+					metricValue, err = App.Storage.GetGaugeValueByName(metricData.ID)
+					return err
 				}
+				metricValue, err = App.Storage.GetGaugeValue(metricData.ID, metricData.Labels)
+				return err
+			})
+			if err != nil {
+				http.Error(rw, fmt.Sprintf("Error 404: %s", err), http.StatusNotFound)
+				App.Logger.Errorln("Error in GaugeStorage:", err)
+				return
 			}
 			metricData.Value = &metricValue
 		} else {
@@ -494,29 +481,173 @@ func (App *Application) UpdateAllValues() http.HandlerFunc {
 				App.Logger.Errorln(fmt.Sprintf("Metric with name %s invalid metric type : %s", metric.ID, metric.MType))
 				return
 			}
-		}
-
-		for i := 0; i <= 3; i++ {
-			err := App.Storage.RepositoryAddAllValues(metricDataList)
-			if err == nil {
-				break
-			}
-			if !(retryerr.CheckErrorType(err)) || (i == 3) {
-				http.Error(rw, fmt.Sprintf("Error while adding all metrics to storage: %s", err), http.StatusInternalServerError)
-				App.Logger.Errorln("Error while adding all metrics to storage", err)
+			if (metric.MType == "counter" && metric.Delta == nil) || (metric.MType == "gauge" && metric.Value == nil) {
+				http.Error(rw, fmt.Sprintf("Error 400: Metric with name %s does not have value", metric.ID), http.StatusBadRequest)
+				App.Logger.Errorln("Metric without value:", metric.ID)
 				return
 			}
+		}
 
-			if i == 0 {
-				time.Sleep(1 * time.Second)
-			} else {
-				time.Sleep(time.Duration(i+i+1) * time.Second)
-			}
+		err = retry.Do(r.Context(), App.RetryPolicy, func() error {
+			return App.Storage.RepositoryAddAllValues(metricDataList)
+		})
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("Error while adding all metrics to storage: %s", err), http.StatusInternalServerError)
+			App.Logger.Errorln("Error while adding all metrics to storage", err)
+			return
+		}
+
+		// response is signed with timestamp and nonce of request, so that agent can check,
+		// that metrics of this request were saved by server with the same key, and earlier response can not be replayed
+		responseBytes, err := json.Marshal(data.UpdatesResponse{Count: len(metricDataList)})
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			App.Logger.Errorln("Error during serialization")
+			return
+		}
+		if App.SecretKey != "" {
+			rw.Header().Set("HashSHA256", data.SignRequest(App.SecretKey, r.Header.Get(data.TimestampHeader), r.Header.Get(data.NonceHeader), responseBytes))
 		}
 
 		rw.Header().Set("Content-Type", "application/json")
 		rw.WriteHeader(http.StatusOK)
+		rw.Write(responseBytes)
 	}
 
 	return http.HandlerFunc(updateAllValuesfunc)
 }
+
+// parseQueryTime - function for parsing time from query parameter in RFC3339 or unix timestamp format.
+func parseQueryTime(value string, defaultTime time.Time) (time.Time, error) {
+	if value == "" {
+		return defaultTime, nil
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return timestamp, nil
+	}
+
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time: %s", value)
+	}
+
+	return time.Unix(0, int64(seconds*float64(time.Second))), nil
+}
+
+// parseQueryStep - function for parsing step from query parameter as duration ("30s") or number of seconds.
+func parseQueryStep(value string) (time.Duration, error) {
+	if value == "" {
+		return time.Minute, nil
+	}
+
+	step, err := time.ParseDuration(value)
+	if err == nil {
+		return step, nil
+	}
+
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid step: %s", value)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// parseQueryLabels - function, that converts list of label parameters in form name=value to labels.
+func parseQueryLabels(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(values))
+	for _, value := range values {
+		name, labelValue, found := strings.Cut(value, "=")
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid label: %s", value)
+		}
+		labels[name] = labelValue
+	}
+
+	return labels, nil
+}
+
+// QueryRange - handler, that retrieves metric history from PostgreSQL or in-memory storage aggregated per step.
+// The function gets name, type, from, to, step, agg and repeated label parameters from URL query.
+func (App *Application) QueryRange() http.HandlerFunc {
+	queryRangefunc := func(rw http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		query := data.RangeQuery{ID: params.Get("name"), MType: params.Get("type"), Aggregation: params.Get("agg")}
+		if query.Aggregation == "" {
+			query.Aggregation = data.AggregationLast
+		}
+
+		var err error
+		query.Labels, err = parseQueryLabels(params["label"])
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("Error 400: %s", err), http.StatusBadRequest)
+			App.Logger.Errorln("Invalid range query:", err)
+			return
+		}
+
+		query.To, err = parseQueryTime(params.Get("to"), time.Now())
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("Error 400: %s", err), http.StatusBadRequest)
+			App.Logger.Errorln("Invalid range query:", err)
+			return
+		}
+
+		query.From, err = parseQueryTime(params.Get("from"), query.To.Add(-time.Hour))
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("Error 400: %s", err), http.StatusBadRequest)
+			App.Logger.Errorln("Invalid range query:", err)
+			return
+		}
+
+		query.Step, err = parseQueryStep(params.Get("step"))
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("Error 400: %s", err), http.StatusBadRequest)
+			App.Logger.Errorln("Invalid range query:", err)
+			return
+		}
+
+		err = query.Validate()
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("Error 400: %s", err), http.StatusBadRequest)
+			App.Logger.Errorln("Invalid range query:", err)
+			return
+		}
+
+		var points []data.Point
+		err = retry.Do(r.Context(), App.RetryPolicy, func() error {
+			points, err = App.Storage.GetMetricRange(query)
+			return err
+		})
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("Error 500: Error while getting history of metric %s", query.ID), http.StatusInternalServerError)
+			App.Logger.Errorln("Error while getting history of metric from Storage:", err)
+			return
+		}
+
+		series := data.Series{ID: query.ID, MType: query.MType, Labels: query.Labels, Aggregation: query.Aggregation, Step: query.Step.String(), Points: points}
+		seriesBytes, err := json.Marshal(series)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			App.Logger.Errorln("Error during serialization")
+			return
+		}
+
+		if App.SecretKey != "" {
+			h := hmac.New(sha256.New, []byte(App.SecretKey))
+			h.Write(seriesBytes)
+			signCheck := h.Sum(nil)
+			rw.Header().Set("HashSHA256", hex.EncodeToString(signCheck))
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(seriesBytes)
+	}
+
+	return http.HandlerFunc(queryRangefunc)
+}
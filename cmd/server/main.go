@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
@@ -21,7 +22,9 @@ import (
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 
+	alerting "github.com/Tanya1515/metrics-collector.git/cmd/alerting"
 	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+	retry "github.com/Tanya1515/metrics-collector.git/cmd/retry"
 	storage "github.com/Tanya1515/metrics-collector.git/cmd/storage"
 	psql "github.com/Tanya1515/metrics-collector.git/cmd/storage/postgresql"
 	str "github.com/Tanya1515/metrics-collector.git/cmd/storage/structure"
@@ -29,10 +32,13 @@ import (
 
 // Application - data type to describe the server work
 type Application struct {
-	Storage   storage.RepositoryInterface // Interface for saving metrics and other data
-	Logger    zap.SugaredLogger           // Application logger
-	SecretKey string                      // Key for data integrity check
-	CryptoKey string                      // Key for encrypting incoming data
+	Storage     storage.RepositoryInterface // Interface for saving metrics and other data
+	Logger      zap.SugaredLogger           // Application logger
+	SecretKey   string                      // Key for data integrity check
+	CryptoKey   string                      // Key for encrypting incoming data
+	Alerts      *alerting.Engine            // Engine for evaluating alerting rules, nil if rules are not configured
+	RetryPolicy retry.Policy                // Policy of repeating storage operations, that failed with temporary errors
+	Nonces      *data.NonceCache            // Nonces of signed requests, which were received recently, for replay protection
 }
 
 func init() {
@@ -44,6 +50,15 @@ func init() {
 	secretKeyFlag = flag.String("k", "", "secret key for hash")
 	cryptoKeyPathFlag = flag.String("crypto-key", "", "path to key for asymmetrical encryption")
 	configFilePathFlag = flag.String("config", "", "path to config file for the application")
+	retentionFlag = flag.Int("retention", 3600, "time duration in seconds for keeping metrics history, 0 - keep forever")
+	rulesFileFlag = flag.String("rules", "", "path to file with alerting rules")
+	rulesIntervalFlag = flag.Int("rules-interval", 15, "time duration in seconds between evaluations of alerting rules")
+	webhooksFlag = flag.String("webhooks", "", "comma-separated list of webhook URLs for alert notifications")
+	grpcAddressFlag = flag.String("grpc-address", "", "address of gRPC server, gRPC server is disabled if address is empty")
+	alertRepeatFlag = flag.Int("alert-repeat-interval", 0, "time duration in seconds for repeating notifications about firing alerts, 0 - do not repeat")
+	maxClockSkewFlag = flag.Int("max-clock-skew", int(data.DefaultMaxClockSkew/time.Second), "maximum difference in seconds between timestamp of signed request and server time")
+	nonceCacheSizeFlag = flag.Int("nonce-cache-size", data.DefaultNonceCacheSize, "maximum number of remembered nonces of signed requests, signed requests are rejected, while cache is full of unexpired nonces")
+	retryFlags = retry.NewFlags()
 }
 
 var (
@@ -55,6 +70,15 @@ var (
 	secretKeyFlag      *string
 	cryptoKeyPathFlag  *string
 	configFilePathFlag *string
+	retentionFlag      *int
+	rulesFileFlag      *string
+	rulesIntervalFlag  *int
+	webhooksFlag       *string
+	alertRepeatFlag    *int
+	grpcAddressFlag    *string
+	maxClockSkewFlag   *int
+	nonceCacheSizeFlag *int
+	retryFlags         *retry.Flags
 	buildVersion       string = "N/A"
 	buildDate          string = "N/A"
 	buildCommit        string = "N/A"
@@ -157,7 +181,160 @@ func main() {
 		restore = configApp.Restore
 	}
 
+	var retention int
+
+	retentionEnv, envExists := os.LookupEnv("RETENTION")
+	if !(envExists) {
+		retention = *retentionFlag
+	} else {
+		retention, err = strconv.Atoi(retentionEnv)
+		if err != nil {
+			fmt.Println("Error when converting string to int:", err)
+		}
+	}
+
+	if retention == 3600 && configFilePath != "" {
+		if configApp.Retention != "" {
+			retention, err = strconv.Atoi(strings.Split(configApp.Retention, "s")[0])
+			if err != nil {
+				fmt.Println("Error when converting string to int: ", err)
+			}
+		}
+	}
+
+	rulesFile, envExists := os.LookupEnv("RULES_FILE")
+	if !(envExists) {
+		rulesFile = *rulesFileFlag
+	}
+
+	if rulesFile == "" && configFilePath != "" {
+		rulesFile = configApp.RulesFile
+	}
+
+	var rulesInterval int
+
+	rulesIntervalEnv, envExists := os.LookupEnv("RULES_INTERVAL")
+	if !(envExists) {
+		rulesInterval = *rulesIntervalFlag
+	} else {
+		rulesInterval, err = strconv.Atoi(rulesIntervalEnv)
+		if err != nil {
+			fmt.Println("Error when converting string to int:", err)
+		}
+	}
+
+	if rulesInterval == 15 && configFilePath != "" {
+		if configApp.RulesInterval != "" {
+			rulesInterval, err = strconv.Atoi(strings.Split(configApp.RulesInterval, "s")[0])
+			if err != nil {
+				fmt.Println("Error when converting string to int: ", err)
+			}
+		}
+	}
+
+	webhooks, envExists := os.LookupEnv("WEBHOOK_URLS")
+	if !(envExists) {
+		webhooks = *webhooksFlag
+	}
+
+	webhookURLs := make([]string, 0)
+	for _, url := range strings.Split(webhooks, ",") {
+		if strings.TrimSpace(url) != "" {
+			webhookURLs = append(webhookURLs, strings.TrimSpace(url))
+		}
+	}
+
+	if len(webhookURLs) == 0 && configFilePath != "" {
+		webhookURLs = configApp.WebhookURLs
+	}
+
+	var alertRepeat int
+
+	alertRepeatEnv, envExists := os.LookupEnv("ALERT_REPEAT_INTERVAL")
+	if !(envExists) {
+		alertRepeat = *alertRepeatFlag
+	} else {
+		alertRepeat, err = strconv.Atoi(alertRepeatEnv)
+		if err != nil {
+			fmt.Println("Error when converting string to int:", err)
+		}
+	}
+
+	if alertRepeat == 0 && configFilePath != "" {
+		if configApp.AlertRepeat != "" {
+			alertRepeat, err = strconv.Atoi(strings.Split(configApp.AlertRepeat, "s")[0])
+			if err != nil {
+				fmt.Println("Error when converting string to int: ", err)
+			}
+		}
+	}
+
+	grpcAddress, envExists := os.LookupEnv("GRPC_ADDRESS")
+	if !(envExists) {
+		grpcAddress = *grpcAddressFlag
+	}
+
+	if grpcAddress == "" && configFilePath != "" {
+		grpcAddress = configApp.GRPCAddress
+	}
+
+	var maxClockSkew int
+
+	maxClockSkewEnv, envExists := os.LookupEnv("MAX_CLOCK_SKEW")
+	if !(envExists) {
+		maxClockSkew = *maxClockSkewFlag
+	} else {
+		maxClockSkew, err = strconv.Atoi(maxClockSkewEnv)
+		if err != nil {
+			fmt.Println("Error when converting string to int:", err)
+		}
+	}
+
+	if maxClockSkew == int(data.DefaultMaxClockSkew/time.Second) && configFilePath != "" {
+		if configApp.MaxClockSkew != "" {
+			maxClockSkew, err = strconv.Atoi(strings.Split(configApp.MaxClockSkew, "s")[0])
+			if err != nil {
+				fmt.Println("Error when converting string to int: ", err)
+			}
+		}
+	}
+
+	var nonceCacheSize int
+
+	nonceCacheSizeEnv, envExists := os.LookupEnv("NONCE_CACHE_SIZE")
+	if !(envExists) {
+		nonceCacheSize = *nonceCacheSizeFlag
+	} else {
+		nonceCacheSize, err = strconv.Atoi(nonceCacheSizeEnv)
+		if err != nil {
+			fmt.Println("Error when converting string to int:", err)
+		}
+	}
+
+	if nonceCacheSize == data.DefaultNonceCacheSize && configFilePath != "" && configApp.NonceCacheSize != 0 {
+		nonceCacheSize = configApp.NonceCacheSize
+	}
+
 	Gctx, cancelG := context.WithCancel(context.Background())
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		panic(err)
+	}
+
+	defer logger.Sync()
+
+	retryPolicy, err := retryFlags.Policy(configApp.Retry, configFilePath)
+	if err != nil {
+		logger.Sugar().Fatalw(err.Error(), "event", "parse retry policy")
+	}
+
+	nonces := data.NewNonceCache(time.Duration(maxClockSkew)*time.Second, nonceCacheSize)
+	err = nonces.Validate()
+	if err != nil {
+		logger.Sugar().Fatalw(err.Error(), "event", "parse replay protection settings")
+	}
+
 	shutdown := make(chan struct{})
 	if postgreSQLAddress != "" {
 		postgreSQLAddrPortDatabase := strings.Split((strings.Split((strings.Split(postgreSQLAddress, "@"))[1], "?"))[0], ":")
@@ -171,18 +348,11 @@ func main() {
 			postgreSQLPort = postgreSQLPortDatabase[0]
 		}
 		postgreSQLAddr := postgreSQLAddrPortDatabase[0]
-		Storage = &psql.PostgreSQLConnection{StoreType: storage.StoreType{Shutdown: shutdown}, Address: postgreSQLAddr, Port: postgreSQLPort, UserName: "postgres", Password: "postgres", DBName: postgreSQLDatabase}
+		Storage = &psql.PostgreSQLConnection{StoreType: storage.StoreType{Retention: retention, Shutdown: shutdown, Logger: logger.Sugar()}, Address: postgreSQLAddr, Port: postgreSQLPort, UserName: "postgres", Password: "postgres", DBName: postgreSQLDatabase}
 	} else {
-		Storage = &str.MemStorage{StoreType: storage.StoreType{Restore: restore, BackupTimer: storeInterval, FileStore: fileStore, Shutdown: shutdown}}
+		Storage = &str.MemStorage{StoreType: storage.StoreType{Restore: restore, BackupTimer: storeInterval, FileStore: fileStore, Retention: retention, Shutdown: shutdown, Logger: logger.Sugar()}}
 	}
 
-	logger, err := zap.NewDevelopment()
-	if err != nil {
-		panic(err)
-	}
-
-	defer logger.Sync()
-
 	secretKeyHash, secretKeyExists := os.LookupEnv("KEY")
 	if !(secretKeyExists) {
 		secretKeyHash = *secretKeyFlag
@@ -192,7 +362,8 @@ func main() {
 		secretKeyHash = configApp.SecretKey
 	}
 
-	App := Application{Storage: Storage, Logger: *logger.Sugar(), SecretKey: secretKeyHash}
+	App := Application{Storage: Storage, Logger: *logger.Sugar(), SecretKey: secretKeyHash, RetryPolicy: retryPolicy,
+		Nonces: nonces}
 
 	App.Logger.Infow(
 		"Starting server",
@@ -216,6 +387,19 @@ func main() {
 		App.Logger.Errorln("Error while database initialization: ", err)
 	}
 
+	if rulesFile != "" {
+		rules, err := alerting.LoadRules(rulesFile, time.Duration(retention)*time.Second)
+		if err != nil {
+			App.Logger.Errorln("Error while loading alerting rules: ", err)
+		} else {
+			App.Alerts = &alerting.Engine{Storage: Storage, Rules: rules, Interval: time.Duration(rulesInterval) * time.Second, Logger: App.Logger}
+			if len(webhookURLs) != 0 {
+				App.Alerts.Notifier = &alerting.Notifier{URLs: webhookURLs, SecretKey: secretKeyHash, RepeatInterval: time.Duration(alertRepeat) * time.Second, RetryPolicy: retryPolicy}
+			}
+			go App.Alerts.Run(Gctx)
+		}
+	}
+
 	commonMiddlewares := []data.Middleware{}
 	if secretKeyHash != "" {
 		commonMiddlewares = append(commonMiddlewares, App.MiddlewareLogger, App.MiddlewareZipper, App.MiddlewareHash, App.MiddlewareUnpack, App.MiddlewareEncrypt)
@@ -226,11 +410,14 @@ func main() {
 	r := chi.NewRouter()
 	r.Route("/", func(r chi.Router) {
 		r.Get("/", App.MiddlewareChain(App.HTMLMetrics(), commonMiddlewares...))
+		r.Get("/metrics", App.MiddlewareChain(App.PrometheusMetrics(), commonMiddlewares...))
 		r.Get("/value/{metricType}/{metricName}", App.MiddlewareChain(App.GetMetricPath(), commonMiddlewares...))
 		r.Post("/update/{metricType}/{metricName}/{metricValue}", App.MiddlewareChain(App.UpdateValuePath(), commonMiddlewares...))
 		r.Post("/value/", App.MiddlewareChain(App.GetMetric(), commonMiddlewares...))
 		r.Post("/update/", App.MiddlewareChain(App.UpdateValue(), commonMiddlewares...))
 		r.Post("/updates/", App.MiddlewareChain(App.UpdateAllValues(), commonMiddlewares...))
+		r.Get("/api/v1/query_range", App.MiddlewareChain(App.QueryRange(), commonMiddlewares...))
+		r.Get("/api/v1/alerts", App.MiddlewareChain(App.AlertsList(), commonMiddlewares...))
 		r.Get("/ping", App.MiddlewareChain(App.CheckStorageConnection(), commonMiddlewares...))
 	})
 
@@ -244,6 +431,22 @@ func main() {
 
 	srv := http.Server{Addr: serverAddress, Handler: r}
 
+	grpcServer := App.NewGRPCServer()
+	if grpcAddress != "" {
+		listen, err := net.Listen("tcp", grpcAddress)
+		if err != nil {
+			App.Logger.Fatalw(err.Error(), "event", "start gRPC server")
+		}
+
+		go func() {
+			App.Logger.Infow("Starting gRPC server", "addr", grpcAddress)
+			err := grpcServer.Serve(listen)
+			if err != nil {
+				App.Logger.Errorln("gRPC server fails with error: ", err)
+			}
+		}()
+	}
+
 	gracefulSutdown := make(chan os.Signal, 1)
 
 	signal.Notify(gracefulSutdown, syscall.SIGINT, syscall.SIGTERM)
@@ -259,6 +462,8 @@ func main() {
 			App.Logger.Errorln("Server shutdown fails with error: ", err)
 		}
 
+		grpcServer.GracefulStop()
+
 		cancelG()
 
 		err = App.Storage.CloseConnections()
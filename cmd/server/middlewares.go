@@ -4,8 +4,9 @@ import (
 	"bytes"
 	"compress/gzip"
 	"crypto/hmac"
-	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -19,13 +20,19 @@ func (App *Application) MiddlewareEncrypt(next http.HandlerFunc) http.HandlerFun
 	return func(w http.ResponseWriter, r *http.Request) {
 		var buf bytes.Buffer
 		var result []byte
-		if strings.Contains(r.Header.Get("X-Encrypted"), "rsa") {
+		encryption := r.Header.Get("X-Encrypted")
+		// names of both schemes contain "rsa", so hybrid scheme is checked inside
+		if strings.Contains(encryption, data.EncryptionRSA) {
 			_, err := buf.ReadFrom(r.Body)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			result, err = data.DecryptData(App.CryptoKey, buf.Bytes())
+			if strings.Contains(encryption, data.EncryptionHybrid) {
+				result, err = data.DecryptData(App.CryptoKey, buf.Bytes())
+			} else {
+				result, err = data.DecryptDataRSA(App.CryptoKey, buf.Bytes())
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				App.Logger.Errorln("Error while decrypting data:", err)
@@ -158,23 +165,43 @@ func (App *Application) MiddlewareHash(next http.HandlerFunc) http.HandlerFunc {
 		// Replace the body with a new reader after reading from the original
 		r.Body = io.NopCloser(bytes.NewBuffer(body))
 
+		// sign covers timestamp and nonce of request, so that signed request can not be replayed
 		sign := r.Header.Get("HashSHA256")
 		if sign != "" {
+			timestamp := r.Header.Get(data.TimestampHeader)
+			nonce := r.Header.Get(data.NonceHeader)
+			if timestamp == "" || nonce == "" {
+				http.Error(w, fmt.Sprintf("Error 400: Signed request must contain %s and %s headers", data.TimestampHeader, data.NonceHeader), http.StatusBadRequest)
+				App.Logger.Errorln("Signed request without timestamp or nonce")
+				return
+			}
+
 			signDecode, err := hex.DecodeString(sign)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				App.Logger.Errorln("Error during HashSHA256 decoding")
 			}
 
-			h := hmac.New(sha256.New, []byte(App.SecretKey))
-			h.Write(body)
-			signCheck := h.Sum(nil)
+			signCheck, _ := hex.DecodeString(data.SignRequest(App.SecretKey, timestamp, nonce, body))
 
 			if !(hmac.Equal(signDecode, signCheck)) {
 				http.Error(w, "Error while checking HashSHA256 of the request", http.StatusBadRequest)
 				App.Logger.Errorln("HashSHA256 is incorrect")
 				return
 			}
+
+			// nonce is remembered only after sign check, so that unsigned requests do not fill the cache
+			err = App.Nonces.Check(timestamp, nonce, time.Now())
+			if errors.Is(err, data.ErrNonceCacheFull) {
+				http.Error(w, fmt.Sprintf("Error 503: %s", err), http.StatusServiceUnavailable)
+				App.Logger.Errorln("Replay protection can not check the request:", err)
+				return
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error 400: %s", err), http.StatusBadRequest)
+				App.Logger.Errorln("Replay protection rejected the request:", err)
+				return
+			}
 		}
 
 		next(&zlw, r)
@@ -2,20 +2,35 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
-
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	alerting "github.com/Tanya1515/metrics-collector.git/cmd/alerting"
 	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+	pb "github.com/Tanya1515/metrics-collector.git/cmd/proto"
 	str "github.com/Tanya1515/metrics-collector.git/cmd/storage/structure"
 )
 
@@ -229,6 +244,18 @@ func TestUpdateValue(t *testing.T) {
 			},
 			modify: "",
 		},
+		{
+			name:    "test: Send counter without value",
+			request: "/update/",
+			metric:  &data.Metrics{ID: "value", MType: "counter"},
+			storage: &str.MemStorage{},
+			result: httpResult{
+				code:        400,
+				response:    "Error 400: Metric with name value does not have value\n",
+				contentType: "text/plain; charset=utf-8",
+			},
+			modify: "",
+		},
 	}
 
 	for _, test := range tests {
@@ -330,6 +357,17 @@ func TestGetMetric(t *testing.T) {
 				contentType: "application/json",
 			},
 		},
+		{
+			name:    "test: Get labelled counter metric",
+			request: "/value/",
+			metric:  &data.Metrics{ID: "PollCount", MType: "counter", Labels: map[string]string{"host": "a"}},
+			storage: &str.MemStorage{},
+			result: httpResult{
+				code:        200,
+				response:    "{\"id\":\"PollCount\",\"type\":\"counter\",\"delta\":7,\"labels\":{\"host\":\"a\"}}",
+				contentType: "application/json",
+			},
+		},
 		{
 			name:    "test: Get not existing gauge metric",
 			request: "/value/",
@@ -374,6 +412,8 @@ func TestGetMetric(t *testing.T) {
 			}
 			test.storage.RepositoryAddCounterValue("PollCount", 1)
 			test.storage.RepositoryAddGaugeValue("BuckHashSys", 0.1)
+			var labelledDelta int64 = 7
+			test.storage.RepositoryAddAllValues([]data.Metrics{{ID: "PollCount", MType: "counter", Delta: &labelledDelta, Labels: map[string]string{"host": "a"}}})
 			var buf bytes.Buffer
 			bodyRequestEncode := json.NewEncoder(&buf)
 			err = bodyRequestEncode.Encode(test.metric)
@@ -540,6 +580,73 @@ func TestGetMetricPath(t *testing.T) {
 
 }
 
+func TestGetMetricByBareName(t *testing.T) {
+	storage := &str.MemStorage{}
+	chanSh := make(chan struct{})
+	require.NoError(t, storage.Init(context.Background(), chanSh))
+
+	value := 1.5
+	delta := int64(3)
+	require.NoError(t, storage.RepositoryAddAllValues([]data.Metrics{
+		{ID: "Alloc", MType: "gauge", Value: &value, Labels: map[string]string{"host": "node-1"}},
+		{ID: "PollCount", MType: "counter", Delta: &delta, Labels: map[string]string{"host": "node-1"}},
+	}))
+
+	logger, err := zap.NewDevelopment()
+	require.NoError(t, err)
+
+	defer logger.Sync()
+	App := Application{Storage: storage, Logger: *logger.Sugar()}
+
+	getPath := func(metricType string, metricName string) (int, string) {
+		request := httptest.NewRequest(http.MethodGet, "/value/", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("metricType", metricType)
+		rctx.URLParams.Add("metricName", metricName)
+		request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
+		w := httptest.NewRecorder()
+		http.HandlerFunc(App.GetMetricPath())(w, request)
+		res := w.Result()
+		defer res.Body.Close()
+		resBody, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(resBody)
+	}
+
+	// the only series of metric is found by bare name
+	code, body := getPath("gauge", "Alloc")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "1.5", body)
+	code, body = getPath("counter", "PollCount")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "3", body)
+
+	var buf bytes.Buffer
+	require.NoError(t, json.NewEncoder(&buf).Encode(data.Metrics{ID: "Alloc", MType: "gauge"}))
+	request := httptest.NewRequest(http.MethodPost, "/value/", &buf)
+	w := httptest.NewRecorder()
+	http.HandlerFunc(App.GetMetric())(w, request)
+	res := w.Result()
+	resBody, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"id":"Alloc","type":"gauge","value":1.5}`, string(resBody))
+
+	// bare name of metric with several series is ambiguous
+	value = 2.5
+	require.NoError(t, storage.RepositoryAddAllValues([]data.Metrics{{ID: "Alloc", MType: "gauge", Value: &value, Labels: map[string]string{"host": "node-2"}}}))
+	code, _ = getPath("gauge", "Alloc")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// series without labels is preferred
+	require.NoError(t, storage.RepositoryAddGaugeValue("Alloc", 0.5))
+	code, body = getPath("gauge", "Alloc")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "0.5", body)
+}
+
 func TestUpdateAllValues(t *testing.T) {
 	var gaugeMetricValue = 1.5
 
@@ -589,6 +696,18 @@ func TestUpdateAllValues(t *testing.T) {
 				contentType: "text/plain; charset=utf-8",
 			},
 		},
+
+		{
+			name:    "test: Add gauge without value",
+			request: "/updates/",
+			metrics: []data.Metrics{{ID: "GaugeMetric", MType: "gauge"}},
+			storage: &str.MemStorage{},
+			result: httpResult{
+				code:        400,
+				response:    "Error 400: Metric with name GaugeMetric does not have value\n",
+				contentType: "text/plain; charset=utf-8",
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -629,6 +748,330 @@ func TestUpdateAllValues(t *testing.T) {
 	}
 }
 
+func TestUpdateAllValuesFromSeveralAgents(t *testing.T) {
+	storage := &str.MemStorage{}
+	chanSh := make(chan struct{})
+	require.NoError(t, storage.Init(context.Background(), chanSh))
+
+	logger, err := zap.NewDevelopment()
+	require.NoError(t, err)
+
+	defer logger.Sync()
+	App := Application{Storage: storage, Logger: *logger.Sugar()}
+
+	for host, value := range map[string]float64{"node-1": 1.5, "node-2": 2.5} {
+		var buf bytes.Buffer
+		metrics := []data.Metrics{{ID: "Alloc", MType: "gauge", Value: &value, Labels: map[string]string{"host": host}}}
+		require.NoError(t, json.NewEncoder(&buf).Encode(metrics))
+
+		request := httptest.NewRequest(http.MethodPost, "/updates/", &buf)
+		w := httptest.NewRecorder()
+		h := http.HandlerFunc(App.UpdateAllValues())
+		h(w, request)
+
+		res := w.Result()
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	value, err := storage.GetGaugeValue("Alloc", map[string]string{"host": "node-1"})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, value)
+
+	value, err = storage.GetGaugeValue("Alloc", map[string]string{"host": "node-2"})
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, value)
+}
+
+func TestUpdateAllValuesSigned(t *testing.T) {
+	storage := &str.MemStorage{}
+	chanSh := make(chan struct{})
+	require.NoError(t, storage.Init(context.Background(), chanSh))
+
+	logger, err := zap.NewDevelopment()
+	require.NoError(t, err)
+
+	defer logger.Sync()
+	App := Application{Storage: storage, Logger: *logger.Sugar(), SecretKey: "secret", Nonces: data.NewNonceCache(time.Minute, 10)}
+	h := App.MiddlewareChain(App.UpdateAllValues(), App.MiddlewareLogger, App.MiddlewareZipper, App.MiddlewareHash, App.MiddlewareUnpack, App.MiddlewareEncrypt)
+
+	value := 1.5
+	metrics := []data.Metrics{{ID: "Alloc", MType: "gauge", Value: &value}}
+	body, err := json.Marshal(metrics)
+	require.NoError(t, err)
+	compressed, err := data.Compress(&metrics)
+	require.NoError(t, err)
+
+	// send - function, that sends compressed metrics with headers and returns response status
+	send := func(headers map[string]string) *http.Response {
+		request := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(compressed))
+		request.Header.Set("Content-Encoding", "gzip")
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		h(w, request)
+		return w.Result()
+	}
+
+	// agent signs metrics before compressing them
+	timestamp := data.NewTimestamp(time.Now())
+	signed := map[string]string{
+		"HashSHA256":         data.SignRequest("secret", timestamp, "nonce-1", body),
+		data.TimestampHeader: timestamp,
+		data.NonceHeader:     "nonce-1",
+	}
+
+	res := send(signed)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	responseBody, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	var response data.UpdatesResponse
+	require.NoError(t, json.Unmarshal(responseBody, &response))
+	assert.Equal(t, 1, response.Count)
+
+	// response is bound to timestamp and nonce of request
+	assert.Equal(t, data.SignRequest("secret", timestamp, "nonce-1", responseBody), res.Header.Get("HashSHA256"))
+
+	rejected := []map[string]string{
+		// replayed request
+		signed,
+		// sign of compressed body
+		{"HashSHA256": data.SignRequest("secret", timestamp, "nonce-2", compressed), data.TimestampHeader: timestamp, data.NonceHeader: "nonce-2"},
+		// timestamp outside of clock skew
+		{"HashSHA256": data.SignRequest("secret", "1000", "nonce-3", body), data.TimestampHeader: "1000", data.NonceHeader: "nonce-3"},
+		// nonce, which is not covered by sign
+		{"HashSHA256": signed["HashSHA256"], data.TimestampHeader: timestamp, data.NonceHeader: "nonce-4"},
+		// sign without timestamp and nonce
+		{"HashSHA256": data.SignRequest("secret", "", "", body)},
+	}
+	for _, headers := range rejected {
+		res := send(headers)
+		res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	}
+
+	// unsigned request is accepted as before
+	res = send(nil)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// request is rejected, while cache is full of nonces, which can still be replayed
+	App.Nonces = data.NewNonceCache(time.Minute, 1)
+	res = send(signed)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res = send(map[string]string{"HashSHA256": data.SignRequest("secret", timestamp, "nonce-5", body), data.TimestampHeader: timestamp, data.NonceHeader: "nonce-5"})
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+}
+
+func TestAlertsList(t *testing.T) {
+	storage := &str.MemStorage{}
+	chanSh := make(chan struct{})
+	require.NoError(t, storage.Init(context.Background(), chanSh))
+	require.NoError(t, storage.RepositoryAddGaugeValue("HeapAlloc", 150))
+
+	logger, err := zap.NewDevelopment()
+	require.NoError(t, err)
+
+	defer logger.Sync()
+	App := Application{Storage: storage, Logger: *logger.Sugar()}
+
+	rule := alerting.Rule{Name: "HighHeap", Type: alerting.RuleThreshold, Metric: "HeapAlloc", Op: ">", Threshold: 100}
+	require.NoError(t, rule.Validate())
+
+	for _, engine := range []*alerting.Engine{nil, {Storage: storage, Rules: []alerting.Rule{rule}}} {
+		App.Alerts = engine
+		expected := 0
+		if engine != nil {
+			_, err = engine.Evaluate(time.Now())
+			require.NoError(t, err)
+			expected = 1
+		}
+
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/alerts", nil)
+		w := httptest.NewRecorder()
+		h := http.HandlerFunc(App.AlertsList())
+		h(w, request)
+
+		res := w.Result()
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var alerts []alerting.Alert
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&alerts))
+		require.Len(t, alerts, expected)
+		if expected != 0 {
+			assert.Equal(t, alerting.StateFiring, alerts[0].State)
+		}
+	}
+}
+
+func TestMiddlewareEncrypt(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+
+	logger, err := zap.NewDevelopment()
+	require.NoError(t, err)
+
+	defer logger.Sync()
+	App := Application{Logger: *logger.Sugar(), CryptoKey: string(privateKeyPEM)}
+
+	tests := []struct {
+		name       string
+		encryption string
+		body       []byte
+		encrypt    func([]byte, []byte) ([]byte, error)
+	}{
+		{
+			name:       "test: decrypt large body encrypted with hybrid scheme",
+			encryption: data.EncryptionHybrid,
+			body:       bytes.Repeat([]byte("a"), 10000),
+			encrypt:    data.EncryptData,
+		},
+		{
+			name:       "test: decrypt body encrypted with RSA",
+			encryption: data.EncryptionRSA,
+			body:       []byte("small body"),
+			encrypt:    data.EncryptDataRSA,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := test.encrypt(test.body, publicKeyPEM)
+			require.NoError(t, err)
+
+			var received []byte
+			h := App.MiddlewareEncrypt(func(rw http.ResponseWriter, r *http.Request) {
+				received, err = io.ReadAll(r.Body)
+				require.NoError(t, err)
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			request := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+			request.Header.Set("X-Encrypted", test.encryption)
+			w := httptest.NewRecorder()
+			h(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+			assert.Equal(t, test.body, received)
+		})
+	}
+}
+
+func TestGRPCUpdateMetrics(t *testing.T) {
+	storage := &str.MemStorage{}
+	chanSh := make(chan struct{})
+	require.NoError(t, storage.Init(context.Background(), chanSh))
+
+	logger, err := zap.NewDevelopment()
+	require.NoError(t, err)
+
+	defer logger.Sync()
+	App := Application{Storage: storage, Logger: *logger.Sugar(), SecretKey: "secret", Nonces: data.NewNonceCache(time.Minute, 10)}
+
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := App.NewGRPCServer()
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewMetricsServiceClient(conn)
+
+	var delta int64 = 5
+	value := 1.5
+	request := pb.FromMetrics([]data.Metrics{{ID: "PollCount", MType: "counter", Delta: &delta, Labels: map[string]string{"host": "a"}}, {ID: "Alloc", MType: "gauge", Value: &value}})
+
+	// signed - function, that makes context with sign of requests, timestamp and nonce
+	signed := func(timestamp time.Time, nonce string, requests ...*pb.UpdateMetricsRequest) context.Context {
+		sign, err := pb.Sign("secret", data.NewTimestamp(timestamp), nonce, requests...)
+		require.NoError(t, err)
+		return metadata.AppendToOutgoingContext(context.Background(), pb.HashMetadataKey, sign,
+			pb.TimestampMetadataKey, data.NewTimestamp(timestamp), pb.NonceMetadataKey, nonce)
+	}
+
+	response, err := client.UpdateMetrics(signed(time.Now(), "nonce-1", request), request)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), response.GetCount())
+
+	// replayed request, request with old timestamp and request without nonce are rejected
+	_, err = client.UpdateMetrics(signed(time.Now(), "nonce-1", request), request)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.UpdateMetrics(signed(time.Now().Add(-time.Hour), "nonce-2", request), request)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	sign, err := pb.Sign("secret", "", "", request)
+	require.NoError(t, err)
+	_, err = client.UpdateMetrics(metadata.AppendToOutgoingContext(context.Background(), pb.HashMetadataKey, sign), request)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	counterValue, err := storage.GetCounterValue("PollCount", map[string]string{"host": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counterValue)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), pb.HashMetadataKey, "incorrect",
+		pb.TimestampMetadataKey, data.NewTimestamp(time.Now()), pb.NonceMetadataKey, "nonce-3")
+	_, err = client.UpdateMetrics(ctx, request)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = client.UpdateMetrics(context.Background(), pb.FromMetrics([]data.Metrics{{ID: "Alloc", MType: "test", Value: &value}}))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err := client.StreamMetrics(signed(time.Now(), "nonce-4", request, request))
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(request))
+	require.NoError(t, stream.Send(request))
+	response, err = stream.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), response.GetCount())
+
+	counterValue, err = storage.GetCounterValue("PollCount", map[string]string{"host": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), counterValue)
+
+	// pools of unsigned stream are saved before stream is closed
+	stream, err = client.StreamMetrics(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(request))
+	assert.Eventually(t, func() bool {
+		counterValue, err := storage.GetCounterValue("PollCount", map[string]string{"host": "a"})
+		return err == nil && counterValue == 20
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, stream.Send(request))
+	response, err = stream.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), response.GetCount())
+
+	// signed stream, that exceeds limit of pools, is rejected
+	stream, err = client.StreamMetrics(signed(time.Now(), "nonce-5", request))
+	require.NoError(t, err)
+	for i := 0; i <= MaxSignedStreamMessages; i++ {
+		err = stream.Send(request)
+		if err != nil {
+			break
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	counterValue, err = storage.GetCounterValue("PollCount", map[string]string{"host": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(25), counterValue)
+}
+
 func BenchmarkGetMetricPath(b *testing.B) {
 	storage := &str.MemStorage{}
 	chanSh := make(chan struct{})
@@ -766,3 +1209,139 @@ func BenchmarkGetMetric(b *testing.B) {
 		handler.ServeHTTP(w, request)
 	}
 }
+
+func TestPrometheusMetrics(t *testing.T) {
+	storage := &str.MemStorage{}
+	chanSh := make(chan struct{})
+	err := storage.Init(context.Background(), chanSh)
+	require.NoError(t, err)
+
+	storage.RepositoryAddCounterValue("PollCount", 5)
+	storage.RepositoryAddGaugeValue("HeapAlloc", 1.5)
+	storage.RepositoryAddGaugeValue("0cpu.util", 2)
+
+	logger, err := zap.NewDevelopment()
+	require.NoError(t, err)
+
+	defer logger.Sync()
+	App := Application{Storage: storage, Logger: *logger.Sugar()}
+
+	request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	h := App.MiddlewareChain(App.PrometheusMetrics(), App.MiddlewareZipper)
+	h(w, request)
+
+	res := w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	assert.Equal(t, data.PrometheusContentType, res.Header.Get("Content-Type"))
+
+	gz, err := gzip.NewReader(res.Body)
+	require.NoError(t, err)
+	resBody, err := io.ReadAll(gz)
+	require.NoError(t, err)
+
+	assert.Equal(t, "# TYPE HeapAlloc gauge\n"+
+		"HeapAlloc 1.5\n"+
+		"# TYPE PollCount counter\n"+
+		"PollCount 5\n"+
+		"# HELP _0cpu_util Metric 0cpu.util\n"+
+		"# TYPE _0cpu_util gauge\n"+
+		"_0cpu_util 2\n", string(resBody))
+}
+
+func TestQueryRange(t *testing.T) {
+	type httpResult struct {
+		code        int
+		contentType string
+		points      int
+	}
+	tests := []struct {
+		name   string
+		query  string
+		result httpResult
+	}{
+		{
+			name:   "test: Get gauge history",
+			query:  "name=HeapAlloc&type=gauge&agg=max&step=1h",
+			result: httpResult{code: 200, contentType: "application/json", points: 1},
+		},
+		{
+			name:   "test: Get counter rate",
+			query:  "name=PollCount&type=counter&agg=rate&step=1h",
+			result: httpResult{code: 200, contentType: "application/json", points: 1},
+		},
+		{
+			name:   "test: Rate for gauge metric",
+			query:  "name=HeapAlloc&type=gauge&agg=rate",
+			result: httpResult{code: 400, contentType: "text/plain; charset=utf-8"},
+		},
+		{
+			name:   "test: Invalid step",
+			query:  "name=HeapAlloc&type=gauge&step=test",
+			result: httpResult{code: 400, contentType: "text/plain; charset=utf-8"},
+		},
+		{
+			name:   "test: Get labelled gauge history",
+			query:  "name=HeapAlloc&type=gauge&label=host=a&step=1h",
+			result: httpResult{code: 200, contentType: "application/json", points: 1},
+		},
+		{
+			name:   "test: Get history of not existing series",
+			query:  "name=HeapAlloc&type=gauge&label=host=b&step=1h",
+			result: httpResult{code: 200, contentType: "application/json", points: 0},
+		},
+		{
+			name:   "test: Invalid label",
+			query:  "name=HeapAlloc&type=gauge&label=host",
+			result: httpResult{code: 400, contentType: "text/plain; charset=utf-8"},
+		},
+		{
+			name:   "test: Invalid metric type",
+			query:  "name=HeapAlloc&type=test",
+			result: httpResult{code: 400, contentType: "text/plain; charset=utf-8"},
+		},
+	}
+
+	storage := &str.MemStorage{}
+	chanSh := make(chan struct{})
+	err := storage.Init(context.Background(), chanSh)
+	require.NoError(t, err)
+
+	storage.RepositoryAddGaugeValue("HeapAlloc", 1.5)
+	storage.RepositoryAddGaugeValue("HeapAlloc", 3.5)
+	storage.RepositoryAddCounterValue("PollCount", 5)
+	storage.RepositoryAddCounterValue("PollCount", 5)
+	labelledValue := 2.5
+	storage.RepositoryAddAllValues([]data.Metrics{{ID: "HeapAlloc", MType: "gauge", Value: &labelledValue, Labels: map[string]string{"host": "a"}}})
+
+	logger, err := zap.NewDevelopment()
+	require.NoError(t, err)
+
+	defer logger.Sync()
+	App := Application{Storage: storage, Logger: *logger.Sugar()}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/query_range?"+test.query, nil)
+			w := httptest.NewRecorder()
+
+			h := http.HandlerFunc(App.QueryRange())
+			h(w, request)
+
+			res := w.Result()
+			defer res.Body.Close()
+			assert.Equal(t, test.result.code, res.StatusCode)
+			assert.Equal(t, test.result.contentType, res.Header.Get("Content-Type"))
+
+			if test.result.code == http.StatusOK {
+				var series data.Series
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&series))
+				assert.Len(t, series.Points, test.result.points)
+			}
+		})
+	}
+}
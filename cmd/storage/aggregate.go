@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"math"
+	"time"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+)
+
+// sampleValue - function, that returns value of history point as float.
+func sampleValue(sample data.Sample) float64 {
+	if sample.Delta != nil {
+		return float64(*sample.Delta)
+	}
+	if sample.Value != nil {
+		return *sample.Value
+	}
+
+	return math.NaN()
+}
+
+// AggregateSamples - function for aggregating time-ordered history points per step of range query.
+// For rate history must start with the last point before range, if it exists.
+// Steps without points are not included into result.
+func AggregateSamples(samples []data.Sample, query data.RangeQuery) []data.Point {
+	type bucket struct {
+		count int
+		sum   float64
+		min   float64
+		max   float64
+		last  float64
+	}
+
+	buckets := make(map[int64]*bucket)
+	order := make([]int64, 0)
+	var prev *data.Sample
+
+	for i := range samples {
+		sample := samples[i]
+		value := sampleValue(sample)
+
+		if sample.Timestamp.After(query.To) {
+			break
+		}
+
+		if sample.Timestamp.Before(query.From) {
+			prev = &samples[i]
+			continue
+		}
+
+		if query.Aggregation == data.AggregationRate {
+			// the increase of counter is counted for the step of the later point,
+			// decreasing value means that counter was reset,
+			// without point before the first one start of series can be removed by retention, so its increase is unknown
+			increase := 0.0
+			if prev != nil {
+				increase = value
+				if value >= sampleValue(*prev) {
+					increase = value - sampleValue(*prev)
+				}
+			}
+			prev = &samples[i]
+			value = increase
+		}
+
+		index := int64(sample.Timestamp.Sub(query.From) / query.Step)
+		b, ok := buckets[index]
+		if !ok {
+			b = &bucket{min: value, max: value}
+			buckets[index] = b
+			order = append(order, index)
+		}
+		b.count++
+		b.sum += value
+		b.min = math.Min(b.min, value)
+		b.max = math.Max(b.max, value)
+		b.last = value
+	}
+
+	points := make([]data.Point, 0, len(order))
+	for _, index := range order {
+		b := buckets[index]
+		point := data.Point{Timestamp: query.From.Add(time.Duration(index) * query.Step)}
+		switch query.Aggregation {
+		case data.AggregationAvg:
+			point.Value = b.sum / float64(b.count)
+		case data.AggregationMin:
+			point.Value = b.min
+		case data.AggregationMax:
+			point.Value = b.max
+		case data.AggregationSum:
+			point.Value = b.sum
+		case data.AggregationLast:
+			point.Value = b.last
+		case data.AggregationRate:
+			point.Value = b.sum / query.Step.Seconds()
+		}
+		points = append(points, point)
+	}
+
+	return points
+}
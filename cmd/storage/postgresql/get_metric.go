@@ -1,30 +1,94 @@
 package postgresql
 
 import (
+	sql "database/sql"
 	"fmt"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
 )
 
+// GetCounterValueByName - function for getting counter value by name without labels.
+// If series without labels does not exist, the only series with such name is used, so that metrics of agent
+// with identity labels can be read by bare name.
 func (db *PostgreSQLConnection) GetCounterValueByName(metricName string) (delta int64, err error) {
 
-	row := db.dbConn.QueryRow("SELECT Delta FROM "+MetricsTableName+" WHERE metricType = $1 AND metricName = $2", "counter", metricName)
+	labels, err := db.seriesByName("counter", metricName)
+	if err != nil {
+		return 0, err
+	}
+
+	return db.GetCounterValue(metricName, labels)
+}
+
+// GetGaugeValueByName - function for getting gauge value by name without labels.
+// If series without labels does not exist, the only series with such name is used, so that metrics of agent
+// with identity labels can be read by bare name.
+func (db *PostgreSQLConnection) GetGaugeValueByName(metricName string) (value float64, err error) {
+
+	labels, err := db.seriesByName("gauge", metricName)
+	if err != nil {
+		return 0, err
+	}
+
+	return db.GetGaugeValue(metricName, labels)
+}
+
+// seriesByName - function, that returns labels of series without labels or of the only series with name metricName.
+func (db *PostgreSQLConnection) seriesByName(metricType string, metricName string) (map[string]string, error) {
+
+	// series without labels is ordered first, the second row matters only if there is no such series
+	rows, err := db.dbConn.Query("SELECT labels FROM "+MetricsTableName+" WHERE metricType = $1 AND metricName = $2 ORDER BY labels = '' DESC LIMIT 2", metricType, metricName)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting series of %s metric %s: %w", metricType, metricName, err)
+	}
+
+	defer rows.Close()
+
+	labelsList := make([]string, 0, 2)
+	for rows.Next() {
+		var labelsString string
+		err = rows.Scan(&labelsString)
+		if err != nil {
+			return nil, fmt.Errorf("error while processing data: %w", err)
+		}
+		labelsList = append(labelsList, labelsString)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("error while getting new data: %w", err)
+	}
+
+	switch {
+	case len(labelsList) == 0:
+		return nil, fmt.Errorf("error while getting %s metric value %w with name %s", metricType, sql.ErrNoRows, metricName)
+	case labelsList[0] == "" || len(labelsList) == 1:
+		return data.ParseLabelsString(labelsList[0])
+	default:
+		return nil, fmt.Errorf("%s metric %s has several series with labels, labels must be set", metricType, metricName)
+	}
+}
+
+func (db *PostgreSQLConnection) GetCounterValue(metricName string, labels map[string]string) (delta int64, err error) {
+
+	row := db.dbConn.QueryRow("SELECT Delta FROM "+MetricsTableName+" WHERE metricType = $1 AND metricName = $2 AND labels = $3", "counter", metricName, data.LabelsString(labels))
 
 	err = row.Scan(&delta)
 	if err != nil {
-		return 0, fmt.Errorf("error while getting counter metric value %w with name %s", err, metricName)
+		return 0, fmt.Errorf("error while getting counter metric value %w with name %s", err, data.SeriesKey(metricName, labels))
 	}
 
 	return
 }
 
-func (db *PostgreSQLConnection) GetGaugeValueByName(metricName string) (value float64, err error) {
+func (db *PostgreSQLConnection) GetGaugeValue(metricName string, labels map[string]string) (value float64, err error) {
 
-	row := db.dbConn.QueryRow("SELECT Value FROM "+MetricsTableName+" WHERE metricType = $1 AND metricName = $2", "gauge", metricName)
+	row := db.dbConn.QueryRow("SELECT Value FROM "+MetricsTableName+" WHERE metricType = $1 AND metricName = $2 AND labels = $3", "gauge", metricName, data.LabelsString(labels))
 
 	err = row.Scan(&value)
 	if err != nil {
-		return 0, fmt.Errorf("error while getting gauge metric value %w with name %s", err, metricName)
+		return 0, fmt.Errorf("error while getting gauge metric value %w with name %s", err, data.SeriesKey(metricName, labels))
 	}
 
 	return
@@ -34,7 +98,7 @@ func (db *PostgreSQLConnection) GetAllGaugeMetrics() (map[string]float64, error)
 
 	gaugeMetrics := make(map[string]float64, 100)
 
-	rows, err := db.dbConn.Query("SELECT metricName, Value FROM "+MetricsTableName+" WHERE metricType = $1", "gauge")
+	rows, err := db.dbConn.Query("SELECT metricName, labels, Value FROM "+MetricsTableName+" WHERE metricType = $1", "gauge")
 	if err != nil {
 		return gaugeMetrics, fmt.Errorf("error while getting all gauge metrics: %w", err)
 	}
@@ -43,12 +107,17 @@ func (db *PostgreSQLConnection) GetAllGaugeMetrics() (map[string]float64, error)
 
 	for rows.Next() {
 		var metricName string
+		var labelsString string
 		var metricValue float64
-		err = rows.Scan(&metricName, &metricValue)
+		err = rows.Scan(&metricName, &labelsString, &metricValue)
 		if err != nil {
 			return gaugeMetrics, fmt.Errorf("error while processing data: %w", err)
 		}
-		gaugeMetrics[metricName] = metricValue
+		labels, err := data.ParseLabelsString(labelsString)
+		if err != nil {
+			return gaugeMetrics, fmt.Errorf("error while parsing labels of metric %s: %w", metricName, err)
+		}
+		gaugeMetrics[data.SeriesKey(metricName, labels)] = metricValue
 	}
 	err = rows.Err()
 	if err != nil {
@@ -62,7 +131,7 @@ func (db *PostgreSQLConnection) GetAllCounterMetrics() (map[string]int64, error)
 
 	conterMetrics := make(map[string]int64, 100)
 
-	rows, err := db.dbConn.Query("SELECT metricName, Delta FROM metrics WHERE metricType = $1", "counter")
+	rows, err := db.dbConn.Query("SELECT metricName, labels, Delta FROM metrics WHERE metricType = $1", "counter")
 	if err != nil {
 		return conterMetrics, fmt.Errorf("error while getting all counter metrics: %w", err)
 	}
@@ -71,13 +140,18 @@ func (db *PostgreSQLConnection) GetAllCounterMetrics() (map[string]int64, error)
 
 	for rows.Next() {
 		var metricName string
+		var labelsString string
 		var metricDelta int64
 
-		err = rows.Scan(&metricName, &metricDelta)
+		err = rows.Scan(&metricName, &labelsString, &metricDelta)
 		if err != nil {
 			return conterMetrics, fmt.Errorf("error while processing data: %w", err)
 		}
-		conterMetrics[metricName] = metricDelta
+		labels, err := data.ParseLabelsString(labelsString)
+		if err != nil {
+			return conterMetrics, fmt.Errorf("error while parsing labels of metric %s: %w", metricName, err)
+		}
+		conterMetrics[data.SeriesKey(metricName, labels)] = metricDelta
 	}
 
 	err = rows.Err()
@@ -87,3 +161,45 @@ func (db *PostgreSQLConnection) GetAllCounterMetrics() (map[string]int64, error)
 
 	return conterMetrics, nil
 }
+
+func (db *PostgreSQLConnection) GetAllMetrics() ([]data.Metrics, error) {
+
+	metrics := make([]data.Metrics, 0, 100)
+
+	rows, err := db.dbConn.Query("SELECT metricName, metricType, labels, Delta, Value FROM " + MetricsTableName)
+	if err != nil {
+		return metrics, fmt.Errorf("error while getting all metrics: %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var metric data.Metrics
+		var labelsString string
+		var delta sql.NullInt64
+		var value sql.NullFloat64
+
+		err = rows.Scan(&metric.ID, &metric.MType, &labelsString, &delta, &value)
+		if err != nil {
+			return metrics, fmt.Errorf("error while processing data: %w", err)
+		}
+		metric.Labels, err = data.ParseLabelsString(labelsString)
+		if err != nil {
+			return metrics, fmt.Errorf("error while parsing labels of metric %s: %w", metric.ID, err)
+		}
+		if delta.Valid {
+			metric.Delta = &delta.Int64
+		}
+		if value.Valid {
+			metric.Value = &value.Float64
+		}
+		metrics = append(metrics, metric)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return metrics, fmt.Errorf("error while getting new data: %w", err)
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,126 @@
+package postgresql
+
+import (
+	sql "database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+	storage "github.com/Tanya1515/metrics-collector.git/cmd/storage"
+)
+
+// addCounterSample - function for adding new point to counter metric history inside transaction.
+func addCounterSample(tx *sql.Tx, metricName string, labels string, metricValue int64, timestamp time.Time) error {
+	_, err := tx.Exec("INSERT INTO "+MetricsHistoryTableName+" (metricType, metricName, labels, Delta, Timestamp) VALUES ($1,$2,$3,$4,$5)", "counter", metricName, labels, metricValue, timestamp)
+	if err != nil {
+		return fmt.Errorf("error while adding counter metric with name %s to history: %w", metricName, err)
+	}
+
+	return nil
+}
+
+// addGaugeSample - function for adding new point to gauge metric history inside transaction.
+func addGaugeSample(tx *sql.Tx, metricName string, labels string, metricValue float64, timestamp time.Time) error {
+	_, err := tx.Exec("INSERT INTO "+MetricsHistoryTableName+" (metricType, metricName, labels, Value, Timestamp) VALUES ($1,$2,$3,$4,$5)", "gauge", metricName, labels, metricValue, timestamp)
+	if err != nil {
+		return fmt.Errorf("error while adding gauge metric with name %s to history: %w", metricName, err)
+	}
+
+	return nil
+}
+
+func (db *PostgreSQLConnection) GetMetricHistory(metricType string, metricName string, labels map[string]string, from time.Time, to time.Time) ([]data.Sample, error) {
+
+	history := make([]data.Sample, 0, 100)
+
+	rows, err := db.dbConn.Query("SELECT Timestamp, Delta, Value FROM "+MetricsHistoryTableName+
+		" WHERE metricType = $1 AND metricName = $2 AND labels = $3 AND Timestamp >= $4 AND Timestamp <= $5 ORDER BY Timestamp, Id", metricType, metricName, data.LabelsString(labels), from, to)
+	if err != nil {
+		return history, fmt.Errorf("error while getting history of metric %s: %w", metricName, err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var sample data.Sample
+		var delta sql.NullInt64
+		var value sql.NullFloat64
+
+		err = rows.Scan(&sample.Timestamp, &delta, &value)
+		if err != nil {
+			return history, fmt.Errorf("error while processing data: %w", err)
+		}
+		if delta.Valid {
+			sample.Delta = &delta.Int64
+		}
+		if value.Valid {
+			sample.Value = &value.Float64
+		}
+		history = append(history, sample)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return history, fmt.Errorf("error while getting new data: %w", err)
+	}
+
+	return history, nil
+}
+
+// lastSampleBefore - function, that returns the last point of metric series, saved before "before", nil if there is no such point.
+func (db *PostgreSQLConnection) lastSampleBefore(metricType string, metricName string, labels map[string]string, before time.Time) (*data.Sample, error) {
+	var sample data.Sample
+	var delta sql.NullInt64
+	var value sql.NullFloat64
+
+	row := db.dbConn.QueryRow("SELECT Timestamp, Delta, Value FROM "+MetricsHistoryTableName+
+		" WHERE metricType = $1 AND metricName = $2 AND labels = $3 AND Timestamp < $4 ORDER BY Timestamp DESC, Id DESC LIMIT 1", metricType, metricName, data.LabelsString(labels), before)
+	err := row.Scan(&sample.Timestamp, &delta, &value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while getting history of metric %s: %w", metricName, err)
+	}
+	if delta.Valid {
+		sample.Delta = &delta.Int64
+	}
+	if value.Valid {
+		sample.Value = &value.Float64
+	}
+
+	return &sample, nil
+}
+
+func (db *PostgreSQLConnection) GetMetricRange(query data.RangeQuery) ([]data.Point, error) {
+	history, err := db.GetMetricHistory(query.MType, query.ID, query.Labels, query.From, query.To)
+	if err != nil {
+		return nil, err
+	}
+
+	// rate needs the last point before range for calculating increase of the first point
+	if query.Aggregation == data.AggregationRate {
+		sample, err := db.lastSampleBefore(query.MType, query.ID, query.Labels, query.From)
+		if err != nil {
+			return nil, err
+		}
+		if sample != nil {
+			history = append([]data.Sample{*sample}, history...)
+		}
+	}
+
+	return storage.AggregateSamples(history, query), nil
+}
+
+func (db *PostgreSQLConnection) RepositoryDeleteOldSamples(before time.Time) error {
+
+	_, err := db.dbConn.Exec("DELETE FROM "+MetricsHistoryTableName+" WHERE Timestamp < $1", before)
+	if err != nil {
+		return fmt.Errorf("error while deleting old points of metrics history: %w", err)
+	}
+
+	return nil
+}
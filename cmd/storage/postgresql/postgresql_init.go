@@ -21,7 +21,8 @@ type PostgreSQLConnection struct {
 }
 
 const (
-	MetricsTableName = "metrics"
+	MetricsTableName        = "metrics"
+	MetricsHistoryTableName = "metrics_history"
 )
 
 func (db *PostgreSQLConnection) Init(ctx context.Context, shutdown chan struct{}) error {
@@ -35,15 +36,57 @@ func (db *PostgreSQLConnection) Init(ctx context.Context, shutdown chan struct{}
 		return err
 	}
 
-	_, err = db.dbConn.Exec(`CREATE TABLE ` + MetricsTableName + ` (Id BIGSERIAL PRIMARY KEY,
-	                                                                metricName VARCHAR(100) NOT NULL UNIQUE,
+	_, err = db.dbConn.Exec(`CREATE TABLE IF NOT EXISTS ` + MetricsTableName + ` (Id BIGSERIAL PRIMARY KEY,
+	                                                                metricName VARCHAR(100) NOT NULL,
 																	metricType VARCHAR(100) NOT NULL,
 																	Delta BIGINT, 
-																	Value DOUBLE PRECISION);`)
+																	Value DOUBLE PRECISION,
+																	labels TEXT NOT NULL DEFAULT '');`)
 	if err != nil {
 		return err
 	}
 
+	// tables, created before labels support, have unique metric name and do not have labels column
+	_, err = db.dbConn.Exec(`ALTER TABLE ` + MetricsTableName + ` ADD COLUMN IF NOT EXISTS labels TEXT NOT NULL DEFAULT '';`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.dbConn.Exec(`ALTER TABLE ` + MetricsTableName + ` DROP CONSTRAINT IF EXISTS ` + MetricsTableName + `_metricname_key;`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.dbConn.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS ` + MetricsTableName + `_series_idx ON ` + MetricsTableName + ` (metricName, metricType, labels);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.dbConn.Exec(`CREATE TABLE IF NOT EXISTS ` + MetricsHistoryTableName + ` (Id BIGSERIAL PRIMARY KEY,
+	                                                                                   metricName VARCHAR(100) NOT NULL,
+	                                                                                   metricType VARCHAR(100) NOT NULL,
+	                                                                                   Delta BIGINT,
+	                                                                                   Value DOUBLE PRECISION,
+	                                                                                   Timestamp TIMESTAMPTZ NOT NULL,
+	                                                                                   labels TEXT NOT NULL DEFAULT '');`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.dbConn.Exec(`ALTER TABLE ` + MetricsHistoryTableName + ` ADD COLUMN IF NOT EXISTS labels TEXT NOT NULL DEFAULT '';`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.dbConn.Exec(`CREATE INDEX IF NOT EXISTS ` + MetricsHistoryTableName + `_labels_idx ON ` + MetricsHistoryTableName + ` (metricType, metricName, labels, Timestamp);`)
+	if err != nil {
+		return err
+	}
+
+	if db.Retention != 0 {
+		go db.CleanHistoryAsync(ctx, db)
+	}
+
 	return nil
 }
 
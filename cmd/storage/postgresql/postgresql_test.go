@@ -81,6 +81,11 @@ func (ts *PostgresTestSuite) clean(ctx context.Context) error {
 	defer cancel()
 
 	_, err := ts.cfg.dbConn.ExecContext(newctx, "DELETE FROM metrics")
+	if err != nil {
+		return err
+	}
+
+	_, err = ts.cfg.dbConn.ExecContext(newctx, "DELETE FROM metrics_history")
 	return err
 }
 
@@ -150,3 +155,27 @@ func (ts *PostgresTestSuite) TestCheckConnection() {
 	defer cancel()
 	ts.NoError(ts.cfg.CheckConnection(newctx))
 }
+
+func (ts *PostgresTestSuite) TestGetMetricHistory() {
+	from := time.Now()
+	ts.NoError(ts.cfg.RepositoryAddGaugeValue("TestGauge", 1.5))
+	ts.NoError(ts.cfg.RepositoryAddGaugeValue("TestGauge", 2.5))
+	ts.NoError(ts.cfg.RepositoryAddCounterValue("TestCounter", 2))
+	ts.NoError(ts.cfg.RepositoryAddCounterValue("TestCounter", 3))
+
+	gaugeHistory, err := ts.cfg.GetMetricHistory("gauge", "TestGauge", nil, from, time.Now())
+	ts.NoError(err)
+	ts.Len(gaugeHistory, 2)
+	ts.Equal(2.5, *gaugeHistory[1].Value)
+
+	counterHistory, err := ts.cfg.GetMetricHistory("counter", "TestCounter", nil, from, time.Now())
+	ts.NoError(err)
+	ts.Len(counterHistory, 2)
+	ts.Equal(int64(5), *counterHistory[1].Delta)
+
+	ts.NoError(ts.cfg.RepositoryDeleteOldSamples(time.Now()))
+
+	gaugeHistory, err = ts.cfg.GetMetricHistory("gauge", "TestGauge", nil, from, time.Now())
+	ts.NoError(err)
+	ts.Empty(gaugeHistory)
+}
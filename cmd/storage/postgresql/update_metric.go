@@ -2,39 +2,71 @@ package postgresql
 
 import (
 	sql "database/sql"
-	"errors"
 	"fmt"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 
 	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
 )
 
-func (db *PostgreSQLConnection) RepositoryAddCounterValue(metricName string, metricValue int64) error {
-	var value int64
+// addCounter - function for increasing counter metric series and adding new point to its history inside transaction.
+// Counter is increased by one statement, so that concurrent transactions do not lose increments of new series.
+func addCounter(tx *sql.Tx, metricName string, labels string, metricValue int64, timestamp time.Time) error {
+	var total int64
 
-	tx, err := db.dbConn.Begin()
+	row := tx.QueryRow("INSERT INTO "+MetricsTableName+" (metricType, metricName, labels, Delta) VALUES ($1,$2,$3,$4)"+
+		" ON CONFLICT (metricName, metricType, labels) DO"+
+		" UPDATE SET Delta = "+MetricsTableName+".Delta + excluded.Delta RETURNING Delta", "counter", metricName, labels, metricValue)
 
+	err := row.Scan(&total)
 	if err != nil {
-		return fmt.Errorf("error while starting transaction: %w", err)
+		return fmt.Errorf("error while adding counter metric with name %s:  %w", metricName, err)
 	}
 
-	row := tx.QueryRow("SELECT Delta FROM "+MetricsTableName+" WHERE metricType = $1 AND metricName = $2 FOR UPDATE", "counter", metricName)
+	return addCounterSample(tx, metricName, labels, total, timestamp)
+}
 
-	err = row.Scan(&value)
-	if (err != nil) && !(errors.Is(err, sql.ErrNoRows)) {
-		tx.Rollback()
-		return fmt.Errorf("error while getting gauge metric value %w with name %s", err, metricName)
+// setCounter - function for replacing value of counter metric series and adding new point to its history inside transaction.
+func setCounter(tx *sql.Tx, metricName string, labels string, metricValue int64, timestamp time.Time) error {
+	_, err := tx.Exec("INSERT INTO "+MetricsTableName+" (metricType, metricName, labels, Delta) VALUES ($1,$2,$3,$4)"+
+		" ON CONFLICT (metricName, metricType, labels) DO"+
+		" UPDATE SET Delta = excluded.Delta", "counter", metricName, labels, metricValue)
+
+	if err != nil {
+		return fmt.Errorf("error while adding counter metric with name %s:  %w", metricName, err)
 	}
 
-	_, err = tx.Exec("INSERT INTO "+MetricsTableName+" (metricType, metricName, Delta) VALUES ($1,$2,$3)"+
-		" ON CONFLICT (metricName) DO"+
-		" UPDATE SET Delta = excluded.Delta WHERE metrics.metricType = excluded.metricType AND metrics.metricName = excluded.metricName", "counter", metricName, metricValue+value)
+	return addCounterSample(tx, metricName, labels, metricValue, timestamp)
+}
+
+// setGauge - function for replacing value of gauge metric series and adding new point to its history inside transaction.
+func setGauge(tx *sql.Tx, metricName string, labels string, metricValue float64, timestamp time.Time) error {
+	_, err := tx.Exec("INSERT INTO "+MetricsTableName+" (metricType, metricName, labels, Value) VALUES ($1,$2,$3,$4)"+
+		" ON CONFLICT (metricName, metricType, labels) DO"+
+		" UPDATE SET Value = excluded.Value", "gauge", metricName, labels, metricValue)
 
+	if err != nil {
+		return fmt.Errorf("error while adding gauge metric with name %s:  %w", metricName, err)
+	}
+
+	return addGaugeSample(tx, metricName, labels, metricValue, timestamp)
+}
+
+func (db *PostgreSQLConnection) RepositoryAddCounterValue(metricName string, metricValue int64) error {
+
+	tx, err := db.dbConn.Begin()
+
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+
+	err = addCounter(tx, metricName, "", metricValue, time.Now())
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("error while adding counter metric with name %s:  %w", metricName, err)
+		return err
 	}
+
 	err = tx.Commit()
 
 	if err != nil {
@@ -49,12 +81,20 @@ func (db *PostgreSQLConnection) RepositoryAddCounterValue(metricName string, met
 
 func (db *PostgreSQLConnection) RepositoryAddGaugeValue(metricName string, metricValue float64) error {
 
-	_, err := db.dbConn.Exec("INSERT INTO "+MetricsTableName+" (metricType, metricName, Value) VALUES($1,$2,$3)"+
-		" ON CONFLICT (metricName) DO"+
-		" UPDATE SET Value = EXCLUDED.Value WHERE metrics.metricType = EXCLUDED.metricType AND metrics.metricName = EXCLUDED.metricName", "gauge", metricName, metricValue)
+	tx, err := db.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
 
+	err = setGauge(tx, metricName, "", metricValue, time.Now())
 	if err != nil {
-		return fmt.Errorf("error during adding new gauge metricValue: %w", err)
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error while closing transaction: %w", err)
 	}
 
 	if (db.FileStore != "") && (db.BackupTimer == 0) {
@@ -65,12 +105,20 @@ func (db *PostgreSQLConnection) RepositoryAddGaugeValue(metricName string, metri
 
 func (db *PostgreSQLConnection) RepositoryAddValue(metricName string, metricValue int64) error {
 
-	_, err := db.dbConn.Exec("INSERT INTO "+MetricsTableName+" (metricType, metricName, Delta) VALUES ($1,$2,$3) "+
-		" ON CONFLICT (metricName) DO"+
-		" UPDATE SET Delta = excluded.Delta WHERE metrics.metricType = excluded.metricType AND metrics.metricName = excluded.metricName", "counter", metricName, metricValue)
+	tx, err := db.dbConn.Begin()
+	if err != nil {
+		return fmt.Errorf("error while starting transaction: %w", err)
+	}
+
+	err = setCounter(tx, metricName, "", metricValue, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 
+	err = tx.Commit()
 	if err != nil {
-		return fmt.Errorf("error during adding new counter metricValue: %w", err)
+		return fmt.Errorf("error while closing transaction: %w", err)
 	}
 	if (db.FileStore != "") && (db.BackupTimer == 0) {
 		db.SaveMetrics(db)
@@ -80,40 +128,29 @@ func (db *PostgreSQLConnection) RepositoryAddValue(metricName string, metricValu
 
 func (db *PostgreSQLConnection) RepositoryAddAllValues(metrics []data.Metrics) error {
 
-	var valueCounter int64
 	tx, err := db.dbConn.Begin()
 
 	if err != nil {
 		return fmt.Errorf("error while starting transaction: %w", err)
 	}
 
+	now := time.Now()
+
 	for _, metric := range metrics {
+		if (metric.MType == "counter" && metric.Delta == nil) || (metric.MType == "gauge" && metric.Value == nil) {
+			tx.Rollback()
+			return fmt.Errorf("metric with name %s does not have value", metric.ID)
+		}
+		labels := data.LabelsString(metric.Labels)
 		if metric.MType == "counter" {
-			row := tx.QueryRow("SELECT Delta FROM "+MetricsTableName+" WHERE metricType = $1 AND metricName = $2 FOR UPDATE", metric.MType, metric.ID)
-
-			err := row.Scan(&valueCounter)
-			if (err != nil) && !(errors.Is(err, sql.ErrNoRows)) {
-				tx.Rollback()
-				return fmt.Errorf("error while getting counter metric value %w", err)
-			}
-			_, err = tx.Exec("INSERT INTO "+MetricsTableName+" (metricType, metricName, Delta) VALUES ($1,$2,$3)"+
-				" ON CONFLICT (metricName) DO"+
-				" UPDATE SET Delta = excluded.Delta WHERE metrics.metricType = excluded.metricType AND metrics.metricName = excluded.metricName", metric.MType, metric.ID, *metric.Delta+valueCounter)
-
-			if err != nil {
-				tx.Rollback()
-				return fmt.Errorf("error while updating counter metric with name %s:  %w", metric.ID, err)
-			}
+			err = addCounter(tx, metric.ID, labels, *metric.Delta, now)
 		} else if metric.MType == "gauge" {
+			err = setGauge(tx, metric.ID, labels, *metric.Value, now)
+		}
 
-			_, err := tx.Exec("INSERT INTO "+MetricsTableName+" (metricType, metricName, Value) VALUES ($1,$2,$3)"+
-				" ON CONFLICT (metricName) DO"+
-				" UPDATE SET Value = excluded.Value WHERE metrics.metricType = excluded.metricType AND metrics.metricName = excluded.metricName", metric.MType, metric.ID, *metric.Value)
-
-			if err != nil {
-				tx.Rollback()
-				return fmt.Errorf("error while adding gauge metric with name %s:  %w", metric.ID, err)
-			}
+		if err != nil {
+			tx.Rollback()
+			return err
 		}
 	}
 
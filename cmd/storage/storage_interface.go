@@ -5,10 +5,13 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
 )
 
+//go:generate mockgen -destination=../mocks/mock_store.go -package=mocks github.com/Tanya1515/metrics-collector.git/cmd/storage RepositoryInterface
+
 type RepositoryInterface interface {
 	// Init - function for initialization in-memoty/PostgreSQL storage.
 	Init(ctx context.Context, shutdown chan struct{}) error
@@ -28,17 +31,37 @@ type RepositoryInterface interface {
 	// GetGaugeValueByName - function for getting gauge metric value by it's name from PostgreSQL/in-memory storage.
 	GetGaugeValueByName(metricName string) (float64, error)
 
+	// GetCounterValue - function for getting counter metric value by it's name and labels from PostgreSQL/in-memory storage.
+	GetCounterValue(metricName string, labels map[string]string) (int64, error)
+
+	// GetGaugeValue - function for getting gauge metric value by it's name and labels from PostgreSQL/in-memory storage.
+	GetGaugeValue(metricName string, labels map[string]string) (float64, error)
+
 	// CheckConnection - function for checking if repository is ok and available.
 	CheckConnection(ctx context.Context) error
 
 	// GetAllGaugeMetrics - function for getting all gauge metrics from PostgreSQL/in-memory storage.
+	// Metrics are identified by series key: name and sorted labels.
 	GetAllGaugeMetrics() (map[string]float64, error)
 
 	// GetAllCounterMetrics - function for getting all counter metrics from PostgreSQL/in-memory storage.
+	// Metrics are identified by series key: name and sorted labels.
 	GetAllCounterMetrics() (map[string]int64, error)
 
+	// GetAllMetrics - function for getting all metrics with their labels from PostgreSQL/in-memory storage.
+	GetAllMetrics() ([]data.Metrics, error)
+
 	// RepositoryAddAllValues - function for updating all metrics as a batch of metrics in PostgreSQL/in-memory storage.
 	RepositoryAddAllValues(metrics []data.Metrics) error
 
+	// GetMetricHistory - function for getting saved points of metric series with timestamps from "from" to "to" from PostgreSQL/in-memory storage.
+	GetMetricHistory(metricType string, metricName string, labels map[string]string, from time.Time, to time.Time) ([]data.Sample, error)
+
+	// GetMetricRange - function for getting metric history from PostgreSQL/in-memory storage aggregated per step of range query.
+	GetMetricRange(query data.RangeQuery) ([]data.Point, error)
+
+	// RepositoryDeleteOldSamples - function for deleting points of metrics history, that were saved before "before".
+	RepositoryDeleteOldSamples(before time.Time) error
+
 	CloseConnections() error
 }
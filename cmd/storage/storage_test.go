@@ -2,13 +2,18 @@ package storage
 
 import (
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
 	"github.com/Tanya1515/metrics-collector.git/cmd/mocks"
 )
 
+// mock must be regenerated, when interface of repository is changed
+var _ RepositoryInterface = (*mocks.MockRepositoryInterface)(nil)
+
 func TestGetCounterValueByName(t *testing.T) {
 
 	// создаём контроллер
@@ -117,3 +122,46 @@ func TestRepositoryAddValue(t *testing.T) {
 
 	require.NoError(t, err)
 }
+
+func TestAggregateSamples(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	gaugeValues := []float64{1, 3, 5, 7}
+	counterValues := []int64{10, 20, 40, 5}
+	counterBefore := int64(5)
+	gaugeSamples := make([]data.Sample, len(gaugeValues))
+	counterSamples := make([]data.Sample, len(counterValues))
+	for i := range gaugeValues {
+		gaugeSamples[i] = data.Sample{Timestamp: from.Add(time.Duration(i*30) * time.Second), Value: &gaugeValues[i]}
+		counterSamples[i] = data.Sample{Timestamp: from.Add(time.Duration(i*30) * time.Second), Delta: &counterValues[i]}
+	}
+
+	tests := []struct {
+		name        string
+		samples     []data.Sample
+		mType       string
+		aggregation string
+		result      []float64
+	}{
+		{name: "test: avg", samples: gaugeSamples, mType: "gauge", aggregation: data.AggregationAvg, result: []float64{2, 6}},
+		{name: "test: min", samples: gaugeSamples, mType: "gauge", aggregation: data.AggregationMin, result: []float64{1, 5}},
+		{name: "test: max", samples: gaugeSamples, mType: "gauge", aggregation: data.AggregationMax, result: []float64{3, 7}},
+		{name: "test: sum", samples: gaugeSamples, mType: "gauge", aggregation: data.AggregationSum, result: []float64{4, 12}},
+		{name: "test: last", samples: counterSamples, mType: "counter", aggregation: data.AggregationLast, result: []float64{20, 5}},
+		{name: "test: rate without point before range", samples: counterSamples, mType: "counter", aggregation: data.AggregationRate, result: []float64{10.0 / 60, 25.0 / 60}},
+		{name: "test: rate with counter reset and old point", samples: append([]data.Sample{{Timestamp: from.Add(-time.Hour), Delta: &counterBefore}}, counterSamples...), mType: "counter", aggregation: data.AggregationRate, result: []float64{15.0 / 60, 25.0 / 60}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query := data.RangeQuery{ID: "Test", MType: test.mType, From: from, To: from.Add(2 * time.Minute), Step: time.Minute, Aggregation: test.aggregation}
+			require.NoError(t, query.Validate())
+
+			points := AggregateSamples(test.samples, query)
+			require.Len(t, points, len(test.result))
+			for i, point := range points {
+				require.Equal(t, from.Add(time.Duration(i)*time.Minute), point.Timestamp)
+				require.InDelta(t, test.result[i], point.Value, 1e-9)
+			}
+		})
+	}
+}
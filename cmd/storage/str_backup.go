@@ -7,6 +7,8 @@ import (
 	"os"
 	"time"
 
+	"go.uber.org/zap"
+
 	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
 )
 
@@ -22,7 +24,9 @@ type StoreType struct {
 	Restore     bool
 	BackupTimer int
 	FileStore   string
+	Retention   int // Time duration in seconds for keeping metrics history, 0 means history is kept forever
 	Shutdown    chan struct{}
+	Logger      *zap.SugaredLogger // Logger for errors of background tasks, nil - errors are not logged
 }
 
 // SaveMetricsAsync - function for saving metrics every
@@ -39,43 +43,33 @@ func (S *StoreType) SaveMetricsAsync(Gctx context.Context, storage RepositoryInt
 	}
 }
 
-// SaveMetrics - function for saving metrics into file asynchronously.
-func (S *StoreType) SaveMetrics(storage RepositoryInterface) (err error) {
-	allMetrics := make([]data.Metrics, 100)
-	gaugeMetric := data.Metrics{ID: "", MType: "gauge"}
-	counterMetric := data.Metrics{ID: "", MType: "counter"}
-	i := 0
-	allGaugeMetrics, err := storage.GetAllGaugeMetrics()
-	if err != nil {
-		return
+// CleanHistoryAsync - function for deleting points of metrics history, that are older than retention window.
+func (S *StoreType) CleanHistoryAsync(Gctx context.Context, storage RepositoryInterface) {
+	cleanInterval := time.Duration(S.Retention) * time.Second / 10
+	if cleanInterval < time.Second {
+		cleanInterval = time.Second
 	}
-	for metricName, metricValue := range allGaugeMetrics {
-		gaugeMetric.ID = metricName
-		gaugeMetric.Value = &metricValue
-		if i < len(allMetrics) {
-			allMetrics[i] = gaugeMetric
-			i += 1
-		} else {
-			allMetrics = append(allMetrics, gaugeMetric)
+	ticker := time.NewTicker(cleanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-Gctx.Done():
+			return
+		case <-ticker.C:
+			err := storage.RepositoryDeleteOldSamples(time.Now().Add(-time.Duration(S.Retention) * time.Second))
+			if err != nil && S.Logger != nil {
+				S.Logger.Errorln("Error while deleting old points of metrics history: ", err)
+			}
 		}
 	}
+}
 
-	allCounterMetrics, err := storage.GetAllCounterMetrics()
+// SaveMetrics - function for saving metrics into file asynchronously.
+func (S *StoreType) SaveMetrics(storage RepositoryInterface) (err error) {
+	allMetrics, err := storage.GetAllMetrics()
 	if err != nil {
 		return
 	}
-	for metricName, metricValue := range allCounterMetrics {
-
-		counterMetric.ID = metricName
-		counterMetric.Delta = &metricValue
-		if i < len(allMetrics) {
-			allMetrics[i] = counterMetric
-			i += 1
-		} else {
-			allMetrics = append(allMetrics, counterMetric)
-		}
-
-	}
 
 	metricsBytes, err := json.Marshal(allMetrics)
 	if err != nil {
@@ -113,6 +107,12 @@ func (S *StoreType) Store(storage RepositoryInterface) error {
 	}
 
 	for _, metric := range allMetrics {
+		if len(metric.Labels) != 0 && (metric.MType == "gauge" || metric.MType == "counter") {
+			// storage is empty during restore, so adding counter value is equal to setting it
+			storage.RepositoryAddAllValues([]data.Metrics{metric})
+			continue
+		}
+
 		if metric.MType == "gauge" {
 			storage.RepositoryAddGaugeValue(metric.ID, *metric.Value)
 		}
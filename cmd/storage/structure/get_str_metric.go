@@ -2,32 +2,91 @@ package structure
 
 import (
 	"github.com/pkg/errors"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
 )
 
+// GetCounterValueByName - function for getting counter value by name without labels.
+// If series without labels does not exist, the only series with such name is used, so that metrics of agent
+// with identity labels can be read by bare name.
 func (S *MemStorage) GetCounterValueByName(metricName string) (int64, error) {
 	S.mutex.Lock()
 
 	defer S.mutex.Unlock()
-	for key, value := range S.counterStorage {
-		if key == metricName {
-			return value, nil
-		}
+	key, err := S.seriesByName(metricName, "counter", func(key string) bool {
+		_, ok := S.counterStorage[key]
+		return ok
+	})
+	if err != nil {
+		return 0, err
 	}
-	return 0, errors.Wrapf(errorMetricExists, "%s does not exist in counter storage", metricName)
+	return S.counterStorage[key], nil
 }
 
+// GetGaugeValueByName - function for getting gauge value by name without labels.
+// If series without labels does not exist, the only series with such name is used, so that metrics of agent
+// with identity labels can be read by bare name.
 func (S *MemStorage) GetGaugeValueByName(metricName string) (float64, error) {
 	S.mutex.Lock()
 
 	defer S.mutex.Unlock()
-	for key, value := range S.gaugeStorage {
-		if key == metricName {
-			return value, nil
+	key, err := S.seriesByName(metricName, "gauge", func(key string) bool {
+		_, ok := S.gaugeStorage[key]
+		return ok
+	})
+	if err != nil {
+		return 0, err
+	}
+	return S.gaugeStorage[key], nil
+}
+
+// seriesByName - function, that finds key of series without labels or of the only series with name metricName.
+// Function exists reports, whether series with key has needed type. Mutex must be locked by caller.
+func (S *MemStorage) seriesByName(metricName string, metricType string, exists func(key string) bool) (string, error) {
+	key := data.SeriesKey(metricName, nil)
+	if exists(key) {
+		return key, nil
+	}
+
+	found := ""
+	for seriesKey, series := range S.seriesStorage {
+		if series.ID != metricName || !exists(seriesKey) {
+			continue
 		}
+		if found != "" {
+			return "", errors.Errorf("%s has several series in %s storage, labels must be set", metricName, metricType)
+		}
+		found = seriesKey
+	}
+	if found == "" {
+		return "", errors.Wrapf(errorMetricExists, "%s does not exist in %s storage", metricName, metricType)
+	}
+
+	return found, nil
+}
+
+func (S *MemStorage) GetCounterValue(metricName string, labels map[string]string) (int64, error) {
+	S.mutex.Lock()
+
+	defer S.mutex.Unlock()
+	key := data.SeriesKey(metricName, labels)
+	if value, ok := S.counterStorage[key]; ok {
+		return value, nil
 	}
-	return 0, errors.Wrapf(errorMetricExists, "%s does not exist in gauge storage", metricName)
+	return 0, errors.Wrapf(errorMetricExists, "%s does not exist in counter storage", key)
 }
- 
+
+func (S *MemStorage) GetGaugeValue(metricName string, labels map[string]string) (float64, error) {
+	S.mutex.Lock()
+
+	defer S.mutex.Unlock()
+	key := data.SeriesKey(metricName, labels)
+	if value, ok := S.gaugeStorage[key]; ok {
+		return value, nil
+	}
+	return 0, errors.Wrapf(errorMetricExists, "%s does not exist in gauge storage", key)
+}
+
 func (S *MemStorage) GetAllGaugeMetrics() (map[string]float64, error) {
 	S.mutex.Lock()
 
@@ -53,3 +112,21 @@ func (S *MemStorage) GetAllCounterMetrics() (map[string]int64, error) {
 
 	return AllCounterMetrics, nil
 }
+
+func (S *MemStorage) GetAllMetrics() ([]data.Metrics, error) {
+	S.mutex.Lock()
+
+	defer S.mutex.Unlock()
+
+	AllMetrics := make([]data.Metrics, 0, len(S.gaugeStorage)+len(S.counterStorage))
+	for key, value := range S.gaugeStorage {
+		series := S.seriesStorage[key]
+		AllMetrics = append(AllMetrics, data.Metrics{ID: series.ID, MType: "gauge", Value: &value, Labels: data.CopyLabels(series.Labels)})
+	}
+	for key, value := range S.counterStorage {
+		series := S.seriesStorage[key]
+		AllMetrics = append(AllMetrics, data.Metrics{ID: series.ID, MType: "counter", Delta: &value, Labels: data.CopyLabels(series.Labels)})
+	}
+
+	return AllMetrics, nil
+}
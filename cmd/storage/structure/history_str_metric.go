@@ -0,0 +1,128 @@
+package structure
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+	storage "github.com/Tanya1515/metrics-collector.git/cmd/storage"
+)
+
+// appendCounterSample - function for adding new point to counter metric history by series key. Mutex must be locked by caller.
+// Points outside of retention window are removed by storage.CleanHistoryAsync.
+func (S *MemStorage) appendCounterSample(key string, metricValue int64, timestamp time.Time) {
+	S.counterHistory[key] = append(S.counterHistory[key], data.Sample{Timestamp: timestamp, Delta: &metricValue})
+}
+
+// appendGaugeSample - function for adding new point to gauge metric history by series key. Mutex must be locked by caller.
+// Points outside of retention window are removed by storage.CleanHistoryAsync.
+func (S *MemStorage) appendGaugeSample(key string, metricValue float64, timestamp time.Time) {
+	S.gaugeHistory[key] = append(S.gaugeHistory[key], data.Sample{Timestamp: timestamp, Value: &metricValue})
+}
+
+// dropOldSamples - function for removing points, that were saved before "before", from time-ordered history.
+func dropOldSamples(history []data.Sample, before time.Time) []data.Sample {
+	i := sort.Search(len(history), func(i int) bool {
+		return !history[i].Timestamp.Before(before)
+	})
+	if i == 0 {
+		return history
+	}
+
+	return append(history[:0:0], history[i:]...)
+}
+
+// seriesHistory - function, that returns history of metric series. Mutex must be locked by caller.
+func (S *MemStorage) seriesHistory(metricType string, metricName string, labels map[string]string) ([]data.Sample, error) {
+	key := data.SeriesKey(metricName, labels)
+	switch metricType {
+	case "counter":
+		return S.counterHistory[key], nil
+	case "gauge":
+		return S.gaugeHistory[key], nil
+	}
+
+	return nil, errors.Errorf("invalid metric type: %s", metricType)
+}
+
+func (S *MemStorage) GetMetricHistory(metricType string, metricName string, labels map[string]string, from time.Time, to time.Time) ([]data.Sample, error) {
+	S.mutex.Lock()
+	defer S.mutex.Unlock()
+
+	history, err := S.seriesHistory(metricType, metricName, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	start := sort.Search(len(history), func(i int) bool {
+		return !history[i].Timestamp.Before(from)
+	})
+	end := sort.Search(len(history), func(i int) bool {
+		return history[i].Timestamp.After(to)
+	})
+	if start >= end {
+		return []data.Sample{}, nil
+	}
+
+	result := make([]data.Sample, end-start)
+	copy(result, history[start:end])
+
+	return result, nil
+}
+
+// lastSampleBefore - function, that returns the last point of metric series, saved before "before", nil if there is no such point.
+func (S *MemStorage) lastSampleBefore(metricType string, metricName string, labels map[string]string, before time.Time) (*data.Sample, error) {
+	S.mutex.Lock()
+	defer S.mutex.Unlock()
+
+	history, err := S.seriesHistory(metricType, metricName, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	i := sort.Search(len(history), func(i int) bool {
+		return !history[i].Timestamp.Before(before)
+	})
+	if i == 0 {
+		return nil, nil
+	}
+	sample := history[i-1]
+
+	return &sample, nil
+}
+
+func (S *MemStorage) GetMetricRange(query data.RangeQuery) ([]data.Point, error) {
+	history, err := S.GetMetricHistory(query.MType, query.ID, query.Labels, query.From, query.To)
+	if err != nil {
+		return nil, err
+	}
+
+	// rate needs the last point before range for calculating increase of the first point
+	if query.Aggregation == data.AggregationRate {
+		sample, err := S.lastSampleBefore(query.MType, query.ID, query.Labels, query.From)
+		if err != nil {
+			return nil, err
+		}
+		if sample != nil {
+			history = append([]data.Sample{*sample}, history...)
+		}
+	}
+
+	return storage.AggregateSamples(history, query), nil
+}
+
+func (S *MemStorage) RepositoryDeleteOldSamples(before time.Time) error {
+	S.mutex.Lock()
+	defer S.mutex.Unlock()
+
+	for key, history := range S.counterHistory {
+		S.counterHistory[key] = dropOldSamples(history, before)
+	}
+	for key, history := range S.gaugeHistory {
+		S.gaugeHistory[key] = dropOldSamples(history, before)
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
 	storage "github.com/Tanya1515/metrics-collector.git/cmd/storage"
 )
 
@@ -16,6 +17,9 @@ type MemStorage struct {
 	storage.StoreType
 	counterStorage map[string]int64
 	gaugeStorage   map[string]float64
+	seriesStorage  map[string]data.Metrics // Name and labels of every metric series by series key
+	counterHistory map[string][]data.Sample
+	gaugeHistory   map[string][]data.Sample
 	mutex          *sync.Mutex
 }
 
@@ -23,6 +27,9 @@ func (S *MemStorage) Init(Gctx context.Context, shutdown chan struct{}) error {
 	var mutex sync.Mutex
 	S.counterStorage = make(map[string]int64, 1000)
 	S.gaugeStorage = make(map[string]float64, 1000)
+	S.seriesStorage = make(map[string]data.Metrics, 1000)
+	S.counterHistory = make(map[string][]data.Sample, 1000)
+	S.gaugeHistory = make(map[string][]data.Sample, 1000)
 	S.mutex = &mutex
 
 	if S.Restore {
@@ -36,6 +43,10 @@ func (S *MemStorage) Init(Gctx context.Context, shutdown chan struct{}) error {
 
 		go S.SaveMetricsAsync(Gctx, S)
 	}
+
+	if S.Retention != 0 {
+		go S.CleanHistoryAsync(Gctx, S)
+	}
 	return nil
 }
 
@@ -3,11 +3,14 @@ package structure
 import (
 	"context"
 	"testing"
+	"time"
 
 	_ "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 
 	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
+	storage "github.com/Tanya1515/metrics-collector.git/cmd/storage"
 )
 
 type InMemoryStorageSuite struct {
@@ -71,3 +74,159 @@ func (MS *InMemoryStorageSuite) TestRepositoryAddAllValues() {
 	MS.NoError(err)
 	MS.Equal(testGaugeAllValue, gaugeRes)
 }
+
+func (MS *InMemoryStorageSuite) TestRepositoryAddAllValuesWithoutValue() {
+	var delta int64 = 5
+	metrics := []data.Metrics{
+		{ID: "TestCounterNoValue", MType: "counter", Delta: &delta},
+		{ID: "TestGaugeNoValue", MType: "gauge"},
+	}
+
+	MS.Error(MS.Storage.RepositoryAddAllValues(metrics))
+
+	_, err := MS.Storage.GetCounterValueByName("TestCounterNoValue")
+	MS.Error(err)
+
+	// storage is not locked after rejected pool
+	MS.NoError(MS.Storage.RepositoryAddCounterValue("TestCounterNoValue", delta))
+}
+
+func (MS *InMemoryStorageSuite) TestRepositoryAddLabelledValues() {
+	var delta int64 = 10
+	value := 1.5
+	metrics := []data.Metrics{
+		{ID: "TestLabelled", MType: "counter", Delta: &delta, Labels: map[string]string{"host": "a"}},
+		{ID: "TestLabelled", MType: "counter", Delta: &delta, Labels: map[string]string{"host": "b"}},
+		{ID: "TestLabelled", MType: "counter", Delta: &delta, Labels: map[string]string{"host": "b"}},
+		{ID: "TestLabelledGauge", MType: "gauge", Value: &value, Labels: map[string]string{"host": "a"}},
+	}
+
+	MS.NoError(MS.Storage.RepositoryAddAllValues(metrics))
+
+	counterA, err := MS.Storage.GetCounterValue("TestLabelled", map[string]string{"host": "a"})
+	MS.NoError(err)
+	MS.Equal(int64(10), counterA)
+
+	counterB, err := MS.Storage.GetCounterValue("TestLabelled", map[string]string{"host": "b"})
+	MS.NoError(err)
+	MS.Equal(int64(20), counterB)
+
+	_, err = MS.Storage.GetCounterValueByName("TestLabelled")
+	MS.Error(err)
+
+	counterValues, err := MS.Storage.GetAllCounterMetrics()
+	MS.NoError(err)
+	MS.Equal(int64(20), counterValues[`TestLabelled{host="b"}`])
+
+	allMetrics, err := MS.Storage.GetAllMetrics()
+	MS.NoError(err)
+	MS.Contains(allMetrics, data.Metrics{ID: "TestLabelledGauge", MType: "gauge", Value: &value, Labels: map[string]string{"host": "a"}})
+
+	history, err := MS.Storage.GetMetricHistory("counter", "TestLabelled", map[string]string{"host": "b"}, time.Time{}, time.Now())
+	MS.NoError(err)
+	MS.Len(history, 2)
+}
+
+func (MS *InMemoryStorageSuite) TestRepositoryAddValueWithBraceInName() {
+	var delta int64 = 3
+	metrics := []data.Metrics{{ID: "TestBrace", MType: "counter", Delta: &delta, Labels: map[string]string{"a": "1"}}}
+	MS.NoError(MS.Storage.RepositoryAddAllValues(metrics))
+	MS.NoError(MS.Storage.RepositoryAddCounterValue(`TestBrace{a="1"}`, 5))
+
+	// metric, which name looks like series key, is a separate series
+	counterRes, err := MS.Storage.GetCounterValue("TestBrace", map[string]string{"a": "1"})
+	MS.NoError(err)
+	MS.Equal(int64(3), counterRes)
+
+	counterRes, err = MS.Storage.GetCounterValueByName(`TestBrace{a="1"}`)
+	MS.NoError(err)
+	MS.Equal(int64(5), counterRes)
+}
+
+func (MS *InMemoryStorageSuite) TestGetMetricHistory() {
+	from := time.Now()
+	MS.NoError(MS.Storage.RepositoryAddGaugeValue("TestGaugeHistory", 1.5))
+	MS.NoError(MS.Storage.RepositoryAddGaugeValue("TestGaugeHistory", 2.5))
+	MS.NoError(MS.Storage.RepositoryAddCounterValue("TestCounterHistory", 2))
+	MS.NoError(MS.Storage.RepositoryAddCounterValue("TestCounterHistory", 3))
+
+	gaugeHistory, err := MS.Storage.GetMetricHistory("gauge", "TestGaugeHistory", nil, from, time.Now())
+	MS.NoError(err)
+	MS.Len(gaugeHistory, 2)
+	MS.Equal(1.5, *gaugeHistory[0].Value)
+	MS.Equal(2.5, *gaugeHistory[1].Value)
+
+	counterHistory, err := MS.Storage.GetMetricHistory("counter", "TestCounterHistory", nil, from, time.Now())
+	MS.NoError(err)
+	MS.Len(counterHistory, 2)
+	MS.Equal(int64(2), *counterHistory[0].Delta)
+	MS.Equal(int64(5), *counterHistory[1].Delta)
+
+	gaugeValue, err := MS.Storage.GetGaugeValueByName("TestGaugeHistory")
+	MS.NoError(err)
+	MS.Equal(2.5, gaugeValue)
+
+	emptyHistory, err := MS.Storage.GetMetricHistory("gauge", "TestGaugeHistory", nil, time.Now().Add(time.Hour), time.Now().Add(2*time.Hour))
+	MS.NoError(err)
+	MS.Empty(emptyHistory)
+}
+
+func (MS *InMemoryStorageSuite) TestRepositoryDeleteOldSamples() {
+	from := time.Now()
+	MS.NoError(MS.Storage.RepositoryAddGaugeValue("TestGaugeRetention", 1))
+	before := time.Now()
+	MS.NoError(MS.Storage.RepositoryAddGaugeValue("TestGaugeRetention", 2))
+
+	MS.NoError(MS.Storage.RepositoryDeleteOldSamples(before))
+
+	history, err := MS.Storage.GetMetricHistory("gauge", "TestGaugeRetention", nil, from, time.Now())
+	MS.NoError(err)
+	MS.Len(history, 1)
+	MS.Equal(2.0, *history[0].Value)
+}
+
+func (MS *InMemoryStorageSuite) TestGetMetricRangeRate() {
+	MS.NoError(MS.Storage.RepositoryAddCounterValue("TestCounterRate", 1000))
+	from := time.Now()
+	MS.NoError(MS.Storage.RepositoryAddCounterValue("TestCounterRate", 5))
+	MS.NoError(MS.Storage.RepositoryAddCounterValue("TestCounterRate", 5))
+
+	query := data.RangeQuery{ID: "TestCounterRate", MType: "counter", From: from, To: time.Now(), Step: time.Hour, Aggregation: data.AggregationRate}
+	MS.NoError(query.Validate())
+
+	// the last point before range is used for increase of the first point in range
+	points, err := MS.Storage.GetMetricRange(query)
+	MS.NoError(err)
+	MS.Len(points, 1)
+	MS.InDelta(10.0/3600, points[0].Value, 1e-9)
+
+	// start of series is removed by retention, so increase of the first point is unknown
+	MS.NoError(MS.Storage.RepositoryDeleteOldSamples(from))
+	points, err = MS.Storage.GetMetricRange(query)
+	MS.NoError(err)
+	MS.Len(points, 1)
+	MS.InDelta(5.0/3600, points[0].Value, 1e-9)
+}
+
+func TestMemStorageRetention(t *testing.T) {
+	memStorage := &MemStorage{StoreType: storage.StoreType{Retention: 1}}
+	chanSh := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, memStorage.Init(ctx, chanSh))
+
+	from := time.Now()
+	require.NoError(t, memStorage.RepositoryAddGaugeValue("TestGauge", 1))
+	time.Sleep(1100 * time.Millisecond)
+	require.NoError(t, memStorage.RepositoryAddGaugeValue("TestGauge", 2))
+
+	// old point is removed by background cleaner
+	var history []data.Sample
+	require.Eventually(t, func() bool {
+		var err error
+		history, err = memStorage.GetMetricHistory("gauge", "TestGauge", nil, from, time.Now())
+		require.NoError(t, err)
+		return len(history) == 1
+	}, 3*time.Second, 50*time.Millisecond)
+	require.Equal(t, 2.0, *history[0].Value)
+}
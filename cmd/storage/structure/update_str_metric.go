@@ -1,12 +1,25 @@
 package structure
 
 import (
+	"fmt"
+	"time"
+
 	data "github.com/Tanya1515/metrics-collector.git/cmd/data"
 )
 
+// addSeries - function for saving name and labels of metric series. Mutex must be locked by caller.
+func (S *MemStorage) addSeries(key string, metricName string, labels map[string]string) {
+	if _, ok := S.seriesStorage[key]; !ok {
+		S.seriesStorage[key] = data.Metrics{ID: metricName, Labels: data.CopyLabels(labels)}
+	}
+}
+
 func (S *MemStorage) RepositoryAddValue(metricName string, metricValue int64) error {
+	key := data.SeriesKey(metricName, nil)
 	S.mutex.Lock()
-	S.counterStorage[metricName] = metricValue
+	S.addSeries(key, metricName, nil)
+	S.counterStorage[key] = metricValue
+	S.appendCounterSample(key, metricValue, time.Now())
 	S.mutex.Unlock()
 
 	if (S.FileStore != "") && (S.BackupTimer == 0) {
@@ -17,8 +30,11 @@ func (S *MemStorage) RepositoryAddValue(metricName string, metricValue int64) er
 }
 
 func (S *MemStorage) RepositoryAddCounterValue(metricName string, metricValue int64) error {
+	key := data.SeriesKey(metricName, nil)
 	S.mutex.Lock()
-	S.counterStorage[metricName] = S.counterStorage[metricName] + metricValue
+	S.addSeries(key, metricName, nil)
+	S.counterStorage[key] = S.counterStorage[key] + metricValue
+	S.appendCounterSample(key, S.counterStorage[key], time.Now())
 	S.mutex.Unlock()
 
 	if (S.FileStore != "") && (S.BackupTimer == 0) {
@@ -29,8 +45,11 @@ func (S *MemStorage) RepositoryAddCounterValue(metricName string, metricValue in
 }
 
 func (S *MemStorage) RepositoryAddGaugeValue(metricName string, metricValue float64) error {
+	key := data.SeriesKey(metricName, nil)
 	S.mutex.Lock()
-	S.gaugeStorage[metricName] = metricValue
+	S.addSeries(key, metricName, nil)
+	S.gaugeStorage[key] = metricValue
+	S.appendGaugeSample(key, metricValue, time.Now())
 	S.mutex.Unlock()
 
 	if (S.FileStore != "") && (S.BackupTimer == 0) {
@@ -41,18 +60,42 @@ func (S *MemStorage) RepositoryAddGaugeValue(metricName string, metricValue floa
 }
 
 func (S *MemStorage) RepositoryAddAllValues(metrics []data.Metrics) error {
+	err := S.addAllValues(metrics)
+	if err != nil {
+		return err
+	}
+
+	if (S.FileStore != "") && (S.BackupTimer == 0) {
+		S.SaveMetrics(S)
+	}
+
+	return nil
+}
+
+// addAllValues - function for saving pool of metrics under mutex. Pool with metric without value is not saved.
+func (S *MemStorage) addAllValues(metrics []data.Metrics) error {
+	for _, metric := range metrics {
+		if (metric.MType == "counter" && metric.Delta == nil) || (metric.MType == "gauge" && metric.Value == nil) {
+			return fmt.Errorf("metric with name %s does not have value", metric.ID)
+		}
+	}
+
 	S.mutex.Lock()
+	defer S.mutex.Unlock()
+
+	now := time.Now()
 	for _, metric := range metrics {
+		key := metric.Key()
 		if metric.MType == "counter" {
-			S.counterStorage[metric.ID] = S.counterStorage[metric.ID] + *metric.Delta
+			S.addSeries(key, metric.ID, metric.Labels)
+			S.counterStorage[key] = S.counterStorage[key] + *metric.Delta
+			S.appendCounterSample(key, S.counterStorage[key], now)
 		} else if metric.MType == "gauge" {
-			S.gaugeStorage[metric.ID] = *metric.Value
+			S.addSeries(key, metric.ID, metric.Labels)
+			S.gaugeStorage[key] = *metric.Value
+			S.appendGaugeSample(key, *metric.Value, now)
 		}
 	}
-	S.mutex.Unlock()
 
-	if (S.FileStore != "") && (S.BackupTimer == 0) {
-		S.SaveMetrics(S)
-	}
 	return nil
 }